@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bitkub2-go/core"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	sessionCookie   = "session"
+	loginCSRFCookie = "login_csrf"
+	csrfHeader      = "X-CSRF-Token"
+	csrfFormField   = "csrf_token"
+)
+
+// secureCookies decides the cookie Secure flag. COOKIE_SECURE=true/false
+// forces it; otherwise it follows the request (TLS or X-Forwarded-Proto).
+func secureCookies(c *gin.Context) bool {
+	switch strings.ToLower(os.Getenv("COOKIE_SECURE")) {
+	case "true", "1":
+		return true
+	case "false", "0":
+		return false
+	}
+	return c.Request.TLS != nil || strings.EqualFold(c.GetHeader("X-Forwarded-Proto"), "https")
+}
+
+// trustedProxies reads TRUSTED_PROXIES, a comma-separated list of proxy
+// IPs/CIDRs whose X-Forwarded-For header is believed.
+func trustedProxies() []string {
+	proxies := []string{}
+	for _, p := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			proxies = append(proxies, p)
+		}
+	}
+	return proxies
+}
+
+func setCookie(c *gin.Context, name string, value string, maxAge int) {
+	c.SetSameSite(http.SameSiteStrictMode)
+	c.SetCookie(name, value, maxAge, "/", "", secureCookies(c), true)
+}
+
+// currentSession returns the valid session behind the request cookie, if any.
+func currentSession(c *gin.Context) (core.Session, bool) {
+	token, err := c.Cookie(sessionCookie)
+	if err != nil || token == "" {
+		return core.Session{}, false
+	}
+	sess, err := core.ValidateSession(token)
+	if err != nil {
+		return core.Session{}, false
+	}
+	return sess, true
+}
+
+func authRequired(c *gin.Context) {
+	sess, ok := currentSession(c)
+	if !ok {
+		c.Redirect(http.StatusSeeOther, "/login")
+		c.Abort()
+		return
+	}
+	if sess.MustChangePassword && c.Request.URL.Path != "/password" && c.Request.URL.Path != "/logout" {
+		c.Redirect(http.StatusSeeOther, "/password")
+		c.Abort()
+		return
+	}
+	c.Set("session", sess)
+	c.Next()
+}
+
+// csrfRequired must run after authRequired. The token comes from the
+// X-CSRF-Token header (fetch) or the csrf_token form field (HTML forms).
+func csrfRequired(c *gin.Context) {
+	sess := c.MustGet("session").(core.Session)
+
+	submitted := c.GetHeader(csrfHeader)
+	if submitted == "" {
+		submitted = c.PostForm(csrfFormField)
+	}
+	if !core.CheckCSRF(sess.CSRFToken, submitted) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "invalid CSRF token"})
+		return
+	}
+	c.Next()
+}
+
+// apiAuth protects /api routes. Scripts authenticate with
+// "Authorization: Bearer <token>" and need a token with the given scope;
+// browsers use their session cookie and must send the CSRF token on
+// anything other than GET. Failures answer with JSON, not a redirect.
+func apiAuth(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if header := c.GetHeader("Authorization"); header != "" {
+			token, found := strings.CutPrefix(header, "Bearer ")
+			if !found {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "expected a Bearer token"})
+				return
+			}
+			apiToken, err := core.ValidateAPIToken(strings.TrimSpace(token))
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+				return
+			}
+			if !apiToken.Allows(scope) {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "API token scope does not allow this action"})
+				return
+			}
+			c.Set("actor", "token:"+apiToken.Name)
+			c.Next()
+			return
+		}
+
+		sess, ok := currentSession(c)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+			return
+		}
+		if sess.MustChangePassword {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "set a new password first"})
+			return
+		}
+		if !core.RoleAllows(sess.Role, scope) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "your role does not allow this action"})
+			return
+		}
+		c.Set("session", sess)
+		c.Set("actor", sess.Username)
+
+		if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+			csrfRequired(c)
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"bitkub2-go/core"
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// runCommand handles the CLI subcommands. The bot itself runs when no
+// subcommand is given.
+func runCommand(name string, args []string) int {
+	switch name {
+	case "backtest":
+		return runBacktest(args)
+	case "paper-reset":
+		return runPaperReset(args)
+	case "token":
+		return runToken(args)
+	case "user":
+		return runUser(args)
+	case "validate-config":
+		return runValidateConfig(args)
+	case "watch-prices":
+		return runWatchPrices(args)
+	}
+
+	fmt.Printf("❌ Unknown command %q\n", name)
+	fmt.Println("Usage: bitkub-rebalance-bot [backtest|paper-reset|token|user|validate-config|watch-prices]")
+	return 2
+}
+
+// runValidateConfig checks a config file together with the env vars the
+// bot would see, without starting it.
+func runValidateConfig(args []string) int {
+	fs := flag.NewFlagSet("validate-config", flag.ExitOnError)
+	path := fs.String("file", os.Getenv("CONFIG_FILE"), "YAML config file to check (default: CONFIG_FILE)")
+	fs.Parse(args)
+
+	if *path == "" {
+		fmt.Println("ℹ️ No config file given, checking env vars only")
+	}
+
+	cfg, err := core.BuildConfig(*path)
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return 1
+	}
+
+	mode := "PRODUCTION"
+	if cfg.DryRun {
+		mode = "DRY_RUN"
+	}
+	fmt.Println("✅ Config is valid")
+	fmt.Printf("   Mode:       %s\n", mode)
+	fmt.Printf("   Targets:    %s\n", core.FormatTargets(cfg.Targets))
+	fmt.Printf("   Threshold:  %.2f%% every %s (min order %.2f THB)\n", cfg.Threshold, cfg.RebalanceInterval, cfg.MinOrderTHB)
+	fmt.Printf("   Strategy:   %s (sizing %s)\n", cfg.StrategyType, cfg.RebalanceSizing)
+	fmt.Printf("   Orders:     %s\n", cfg.OrderType)
+	if cfg.MaxOrderTHB > 0 || cfg.MaxTradesPerRun > 0 {
+		fmt.Printf("   Risk:       max order %.2f THB, max %d trades per run (0 = no limit)\n", cfg.MaxOrderTHB, cfg.MaxTradesPerRun)
+	}
+	return 0
+}
+
+func runBacktest(args []string) int {
+	fs := flag.NewFlagSet("backtest", flag.ExitOnError)
+	dataPath := fs.String("data", "", "CSV file with historical prices (required)")
+	asset := fs.String("asset", "", "asset symbol for single-asset CSV files without an asset column")
+	targets := fs.String("targets", "", "target weights, e.g. THB:50,BTC:30,ETH:20 (default: TARGET_WEIGHTS / ASSET_SYMBOLS)")
+	threshold := fs.Float64("threshold", envFloat("THRESHOLD_PERCENTAGE", 1.0), "rebalance threshold in percent")
+	initial := fs.Float64("initial", envFloat("INITIAL_INVESTMENT", 100000), "starting THB balance")
+	fee := fs.Float64("fee", 0.25, "trading fee in percent")
+	slippage := fs.Float64("slippage", 0.1, "slippage in percent")
+	minOrder := fs.Float64("min-order", core.MinOrderTHB, "minimum buy order in THB")
+	strategyType := fs.String("strategy", envString("STRATEGY", core.StrategyThreshold), "threshold, relative_band, periodic or hybrid")
+	period := fs.String("period", envString("STRATEGY_PERIOD", "monthly"), "daily, weekly or monthly (periodic, hybrid)")
+	band := fs.Float64("band", envFloat("STRATEGY_BAND_PCT", 25), "deviation as % of target (relative_band, hybrid)")
+	sizing := fs.String("sizing", envString("REBALANCE_SIZING", core.SizingFull), "how much of the gap to trade: full, band or fraction")
+	fraction := fs.Float64("fraction", envFloat("REBALANCE_FRACTION", 0.5), "share of the gap to trade with -sizing fraction")
+	fs.Parse(args)
+
+	if *dataPath == "" {
+		fmt.Println("❌ -data is required")
+		fs.Usage()
+		return 2
+	}
+
+	weights, symbols := *targets, ""
+	if weights == "" {
+		weights, symbols = os.Getenv("TARGET_WEIGHTS"), os.Getenv("ASSET_SYMBOLS")
+		if weights == "" && symbols == "" {
+			symbols = *asset
+		}
+	}
+	targetAssets, err := core.ParseTargetWeights(weights, symbols)
+	if err != nil {
+		fmt.Printf("❌ Invalid target weights: %v\n", err)
+		return 1
+	}
+
+	strategyConfig := core.StrategyConfig{
+		Type:    *strategyType,
+		Period:  *period,
+		BandPct: *band,
+		Sizing:  core.Sizing{Mode: strings.ToLower(*sizing), Fraction: *fraction},
+	}
+	strategy, err := core.NewStrategy(strategyConfig, *threshold, *minOrder, nil)
+	if err != nil {
+		fmt.Printf("❌ Invalid strategy: %v\n", err)
+		return 1
+	}
+
+	points, err := core.LoadPriceCSV(*dataPath, *asset)
+	if err != nil {
+		fmt.Printf("❌ Failed to load price data: %v\n", err)
+		return 1
+	}
+
+	backtestConfig := core.BacktestConfig{
+		Targets:     targetAssets,
+		Threshold:   *threshold,
+		InitialTHB:  *initial,
+		FeePct:      *fee,
+		SlippagePct: *slippage,
+		MinOrderTHB: *minOrder,
+		Strategy:    strategy,
+	}
+	result, err := core.RunBacktest(backtestConfig, points)
+	if err != nil {
+		fmt.Printf("❌ Backtest failed: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("Targets: %s | Strategy: %s | Fee: %.2f%% | Slippage: %.2f%%\n",
+		core.FormatTargets(targetAssets), strategy.Name(), *fee, *slippage)
+	result.Print()
+
+	// Replay with full rebalancing so the savings of partial sizing show up.
+	if strategyConfig.Sizing.Mode != core.SizingFull {
+		strategyConfig.Sizing = core.Sizing{Mode: core.SizingFull}
+		backtestConfig.Strategy, _ = core.NewStrategy(strategyConfig, *threshold, *minOrder, nil)
+		full, err := core.RunBacktest(backtestConfig, points)
+		if err != nil {
+			fmt.Printf("❌ Backtest failed: %v\n", err)
+			return 1
+		}
+		result.PrintComparison(full)
+	}
+	return 0
+}
+
+// runWatchPrices prints the prices the WebSocket price feed receives, to
+// check a feed URL (or a local fake server) without starting the bot.
+func runWatchPrices(args []string) int {
+	fs := flag.NewFlagSet("watch-prices", flag.ExitOnError)
+	url := fs.String("url", envString("MARKET_WS_URL", core.MarketWSURL), "WebSocket base URL")
+	assets := fs.String("assets", "", "comma-separated assets (default: TARGET_WEIGHTS / ASSET_SYMBOLS)")
+	heartbeat := fs.Duration("heartbeat", core.MarketWSHeartbeat, "ping interval")
+	fs.Parse(args)
+
+	feed := &core.PriceFeed{URL: *url, Heartbeat: *heartbeat}
+	if *assets != "" {
+		feed.Assets = strings.Split(strings.ToUpper(*assets), ",")
+	} else {
+		targets, err := core.ParseTargetWeights(os.Getenv("TARGET_WEIGHTS"), os.Getenv("ASSET_SYMBOLS"))
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			return 2
+		}
+		for asset := range targets {
+			if asset != "THB" {
+				feed.Assets = append(feed.Assets, asset)
+			}
+		}
+	}
+	feed.OnPrice = func(asset string, price float64, at time.Time) {
+		fmt.Printf("%s %-5s %.2f THB\n", at.Format("15:04:05.000"), asset, price)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	fmt.Printf("📡 Connecting to %s\n", feed.StreamURL())
+	if err := feed.Run(ctx); err != nil && ctx.Err() == nil {
+		fmt.Printf("❌ %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// runPaperReset clears the DRY_RUN paper wallet so the next run starts again
+// from INITIAL_INVESTMENT.
+func runPaperReset(args []string) int {
+	if err := core.InitDB(os.Getenv("DB_PATH")); err != nil {
+		fmt.Printf("Fatal error during DB initialization: %v\n", err)
+		return 1
+	}
+	defer core.DB.Close()
+
+	if err := core.ResetPaperWallet(); err != nil {
+		fmt.Printf("❌ Failed to reset paper wallet: %v\n", err)
+		return 1
+	}
+	fmt.Println("🧪 Paper wallet cleared. It will be funded from INITIAL_INVESTMENT on the next run.")
+	return 0
+}
+
+// runToken manages API tokens for scripts:
+//
+//	token create -name NAME -scope read|control
+//	token list
+//	token revoke -id ID
+func runToken(args []string) int {
+	if len(args) == 0 {
+		fmt.Println("Usage: token create|list|revoke")
+		return 2
+	}
+
+	if err := core.InitDB(os.Getenv("DB_PATH")); err != nil {
+		fmt.Printf("Fatal error during DB initialization: %v\n", err)
+		return 1
+	}
+	defer core.DB.Close()
+
+	fs := flag.NewFlagSet("token "+args[0], flag.ExitOnError)
+	name := fs.String("name", "", "token name, e.g. the script that uses it")
+	scope := fs.String("scope", core.ScopeRead, "read or control")
+	id := fs.Int("id", 0, "token id to revoke")
+	fs.Parse(args[1:])
+
+	switch args[0] {
+	case "create":
+		token, err := core.CreateAPIToken(*name, *scope)
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			return 1
+		}
+		fmt.Printf("🔑 Token %q (%s) created. Store it now, it will not be shown again:\n%s\n", *name, *scope, token)
+	case "list":
+		tokens, err := core.ListAPITokens()
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			return 1
+		}
+		for _, t := range tokens {
+			lastUsed := "never"
+			if t.LastUsedAt != nil {
+				lastUsed = t.LastUsedAt.Format("02/01/2006 15:04:05")
+			}
+			status := "active"
+			if t.Revoked {
+				status = "revoked"
+			}
+			fmt.Printf("%3d  %-20s %-8s %-8s last used: %s\n", t.ID, t.Name, t.Scope, status, lastUsed)
+		}
+	case "revoke":
+		if err := core.RevokeAPIToken(*id); err != nil {
+			fmt.Printf("❌ %v\n", err)
+			return 1
+		}
+		fmt.Printf("🗑️ Token %d revoked\n", *id)
+	default:
+		fmt.Printf("❌ Unknown token command %q\n", args[0])
+		return 2
+	}
+	return 0
+}
+
+// runUser manages dashboard users:
+//
+//	user create -username NAME -role viewer|operator|admin [-password PASS]
+//	user reset -username NAME [-password PASS]
+//	user role -username NAME -role viewer|operator|admin
+//	user list
+//	user delete -username NAME
+//
+// Without -password the password is read from stdin, which keeps it out of
+// the shell history.
+func runUser(args []string) int {
+	if len(args) == 0 {
+		fmt.Println("Usage: user create|reset|role|list|delete")
+		return 2
+	}
+
+	if err := core.InitDB(os.Getenv("DB_PATH")); err != nil {
+		fmt.Printf("Fatal error during DB initialization: %v\n", err)
+		return 1
+	}
+	defer core.DB.Close()
+
+	fs := flag.NewFlagSet("user "+args[0], flag.ExitOnError)
+	username := fs.String("username", "", "dashboard username")
+	password := fs.String("password", "", "password (read from stdin when omitted)")
+	// No default, so "user role" without -role cannot demote anyone by accident.
+	role := fs.String("role", "", "viewer, operator or admin (create defaults to viewer)")
+	fs.Parse(args[1:])
+
+	readPassword := func() string {
+		if *password != "" {
+			return *password
+		}
+		fmt.Print("Password: ")
+		line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		return strings.TrimRight(line, "\r\n")
+	}
+
+	var err error
+	switch args[0] {
+	case "create":
+		if *role == "" {
+			*role = core.RoleViewer
+		}
+		if err = core.CreateUser(*username, readPassword(), *role); err == nil {
+			fmt.Printf("👤 User %q created with role %s\n", *username, *role)
+		}
+	case "reset":
+		if err = core.SetUserPassword(*username, readPassword()); err == nil {
+			fmt.Printf("🔑 Password for %q reset, existing sessions logged out\n", *username)
+		}
+	case "role":
+		if *role == "" {
+			fmt.Println("❌ user role needs -role viewer|operator|admin")
+			return 2
+		}
+		if err = core.SetUserRole(*username, *role); err == nil {
+			fmt.Printf("👤 User %q is now %s\n", *username, *role)
+		}
+	case "delete":
+		if err = core.DeleteUser(*username); err == nil {
+			fmt.Printf("🗑️ User %q deleted\n", *username)
+		}
+	case "list":
+		var users []core.User
+		if users, err = core.ListUsers(); err == nil {
+			for _, u := range users {
+				fmt.Printf("%3d  %-20s %-9s created %s\n", u.ID, u.Username, u.Role, u.CreatedAt.Format("02/01/2006 15:04"))
+			}
+		}
+	default:
+		fmt.Printf("❌ Unknown user command %q\n", args[0])
+		return 2
+	}
+
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func envString(key string, fallback string) string {
+	if val := os.Getenv(key); val != "" {
+		return val
+	}
+	return fallback
+}
+
+func envFloat(key string, fallback float64) float64 {
+	if val, err := strconv.ParseFloat(os.Getenv(key), 64); err == nil {
+		return val
+	}
+	return fallback
+}
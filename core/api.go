@@ -2,18 +2,36 @@ package core
 
 import (
 	"bytes"
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
 )
 
+// BitkubExchange talks to the Bitkub REST API. Cancelling ctx (on
+// shutdown) stops calls from waiting out retries and rate limit pauses,
+// except the order lookups and cancels that settle an order already placed.
+type BitkubExchange struct {
+	BaseURL   string
+	APIKey    string
+	APISecret string
+
+	ctx context.Context
+}
+
+func NewBitkubExchange(ctx context.Context, baseURL string, apiKey string, apiSecret string) *BitkubExchange {
+	return &BitkubExchange{BaseURL: baseURL, APIKey: apiKey, APISecret: apiSecret, ctx: ctx}
+}
+
+func (b *BitkubExchange) Name() string { return "bitkub" }
+
 func signPayload(apiSecret string, timestamp string, method string, endpoint string, body []byte) string {
 	sigBody := ""
 	if len(body) > 0 {
@@ -27,146 +45,325 @@ func signPayload(apiSecret string, timestamp string, method string, endpoint str
 	return hex.EncodeToString(h.Sum(nil))
 }
 
-func sendPrivateRequest(endpoint string, method string, payload map[string]interface{}) ([]byte, error) {
-	if APIKey == "your_api_key_here" || APISecret == "your_api_secret_here" {
+// sendPrivateRequest signs and sends a call to a private endpoint.
+// idempotent marks calls that are safe to send twice (reads and cancels);
+// orders are only retried when Bitkub never saw them. ctx ends the waits
+// between retries.
+func (b *BitkubExchange) sendPrivateRequest(ctx context.Context, endpoint string, method string, payload map[string]interface{}, idempotent bool) ([]byte, error) {
+	if b.APIKey == "your_api_key_here" || b.APISecret == "your_api_secret_here" {
 		return nil, fmt.Errorf("API Keys not configured. Please check config.go")
 	}
 
 	payloadBytes := []byte{}
 	if len(payload) > 0 {
-		payloadBytes, _ = json.Marshal(payload)
-	}
-	timestamp := strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 10)
-	signature := signPayload(APISecret, timestamp, method, "/api/"+endpoint, payloadBytes)
-	req, _ := http.NewRequest(method, APIUrl+"/"+endpoint, bytes.NewBuffer(payloadBytes))
-	req.Header.Set("Accept", "application/json")
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("X-BTK-TIMESTAMP", timestamp)
-	req.Header.Set("X-BTK-SIGN", signature)
-	req.Header.Set("X-BTK-APIKEY", APIKey)
-
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
+		var err error
+		if payloadBytes, err = json.Marshal(payload); err != nil {
+			return nil, fmt.Errorf("failed to encode %s payload: %w", endpoint, err)
+		}
+	}
+
+	label, _, _ := strings.Cut(endpoint, "?")
+	return bitkubClient.Do(ctx, apiRequest{
+		Endpoint:   label,
+		Idempotent: idempotent,
+		Build: func() (*http.Request, error) {
+			timestamp := strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 10)
+			signature := signPayload(b.APISecret, timestamp, method, "/api/"+endpoint, payloadBytes)
+			req, err := http.NewRequest(method, b.BaseURL+"/"+endpoint, bytes.NewReader(payloadBytes))
+			if err != nil {
+				return nil, err
+			}
+			req.Header.Set("Accept", "application/json")
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("X-BTK-TIMESTAMP", timestamp)
+			req.Header.Set("X-BTK-SIGN", signature)
+			req.Header.Set("X-BTK-APIKEY", b.APIKey)
+			return req, nil
+		},
+	})
+}
+
+func (b *BitkubExchange) fetchTicker(asset string) (map[string]interface{}, error) {
+	sym := "THB_" + asset
+	body, err := bitkubClient.Do(b.ctx, apiRequest{
+		Endpoint:   "market/ticker",
+		Idempotent: true,
+		Build: func() (*http.Request, error) {
+			req, err := http.NewRequest("GET", b.BaseURL+"/market/ticker?sym="+sym, nil)
+			if err != nil {
+				return nil, err
+			}
+			req.Header.Set("Accept", "application/json")
+			return req, nil
+		},
+	})
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
 
-	body, _ := io.ReadAll(resp.Body)
-	var errorCheck map[string]interface{}
-	if err := json.Unmarshal(body, &errorCheck); err == nil {
-		if code, ok := errorCheck["error"].(float64); ok && code != 0 {
-			return nil, fmt.Errorf("bitkub API error code %d: %s", int(code), string(body))
-		}
+	var result map[string]map[string]interface{}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode ticker JSON: %v", err)
+	}
+
+	data, ok := result[sym]
+	if !ok {
+		return nil, fmt.Errorf("price not found or invalid format for %s", sym)
 	}
+	return data, nil
+}
 
-	return body, nil
+// tickerField reads a ticker number that Bitkub may send as a string or a number.
+func tickerField(data map[string]interface{}, key string) (float64, bool) {
+	if valueStr, ok := data[key].(string); ok {
+		if value, err := strconv.ParseFloat(valueStr, 64); err == nil {
+			return value, true
+		}
+	}
+	if valueFloat, ok := data[key].(float64); ok {
+		return valueFloat, true
+	}
+	return 0, false
 }
 
-func FetchTickerPrice(sym string) (float64, error) {
-	resp, err := http.Get(APIUrl + "/market/ticker?sym=" + sym)
+func (b *BitkubExchange) Ticker(asset string) (float64, error) {
+	data, err := b.fetchTicker(asset)
 	if err != nil {
 		return 0, err
 	}
-	defer resp.Body.Close()
 
-	body, _ := io.ReadAll(resp.Body)
+	if lastPrice, ok := tickerField(data, "last"); ok {
+		return lastPrice, nil
+	}
 
-	var result map[string]map[string]interface{}
-	if err := json.Unmarshal(body, &result); err != nil {
-		return 0, fmt.Errorf("failed to decode ticker JSON: %v", err)
+	return 0, fmt.Errorf("price not found or invalid format for THB_%s", asset)
+}
+
+func (b *BitkubExchange) Quote(asset string) (Quote, error) {
+	data, err := b.fetchTicker(asset)
+	if err != nil {
+		return Quote{}, err
 	}
 
-	if data, ok := result[sym]; ok {
-		if lastPriceStr, ok := data["last"].(string); ok {
-			if lastPrice, err := strconv.ParseFloat(lastPriceStr, 64); err == nil {
-				return lastPrice, nil
-			}
-		}
-		if lastPriceFloat, ok := data["last"].(float64); ok {
-			return lastPriceFloat, nil
-		}
+	last, _ := tickerField(data, "last")
+	bid, okBid := tickerField(data, "highestBid")
+	ask, okAsk := tickerField(data, "lowestAsk")
+	if !okBid || !okAsk || bid <= 0 || ask <= 0 {
+		return Quote{}, fmt.Errorf("best bid/ask not available for THB_%s", asset)
 	}
 
-	return 0, fmt.Errorf("price not found or invalid format for %s", sym)
+	return Quote{Last: last, Bid: bid, Ask: ask}, nil
 }
 
-func FetchWalletBalance() (map[string]float64, error) {	
-	respBody, err := sendPrivateRequest("v3/market/wallet", "POST", map[string]interface{}{})
+func (b *BitkubExchange) Balances() (map[string]float64, error) {
+	respBody, err := b.sendPrivateRequest(b.ctx, "v3/market/wallet", "POST", map[string]interface{}{}, true)
 	if err != nil {
 		return nil, err
 	}
 
+	var walletResp walletResponse
 	if err := json.Unmarshal(respBody, &walletResp); err != nil {
 		return nil, fmt.Errorf("failed to decode wallet JSON: %v", err)
 	}
 
 	balances := make(map[string]float64)
-	balances["THB"] = 0.0
-	balances[CoinAsset] = 0.0
-
 	for asset, balanceValue := range walletResp.Result {
-		if asset == "THB" || asset == CoinAsset {
-			balances[asset] = balanceValue
-		}
+		balances[asset] = balanceValue
 	}
 
 	return balances, nil
 }
 
-func SendOrder(sym string, amount float64, op string) error {
-	if amount <= 0 {
-		return fmt.Errorf("cannot send order with non-positive amount: %.8f", amount)
+func (b *BitkubExchange) PlaceOrder(req OrderRequest) (Order, error) {
+	if req.Amount <= 0 {
+		return Order{}, fmt.Errorf("cannot send order with non-positive amount: %.8f", req.Amount)
 	}
 
-	if !strings.HasSuffix(sym, "_THB") {
-		return fmt.Errorf("invalid trading symbol format: must end with _THB")
+	if req.Type == "" {
+		req.Type = "market"
 	}
+	sym := req.Asset + "_THB"
 
-	switch op {
+	switch req.Side {
 	case "buy":
-		return sendOrderRequest("v3/market/place-bid", sym, amount, op)
+		return b.sendOrderRequest("v3/market/place-bid", sym, req)
 	case "sell":
-		return sendOrderRequest("v3/market/place-ask", sym, amount, op)
+		return b.sendOrderRequest("v3/market/place-ask", sym, req)
 	}
 
-	return fmt.Errorf("invalid operation: must be 'buy' or 'sell'")
+	return Order{}, fmt.Errorf("invalid operation: must be 'buy' or 'sell'")
 }
 
-func sendOrderRequest(endpoint string, sym string, amount float64, op string) error {
-	rate := 0.0
+func (b *BitkubExchange) sendOrderRequest(endpoint string, sym string, req OrderRequest) (Order, error) {
 	precision := 8
-	if op == "buy" {
+	if req.Side == "buy" {
 		precision = 2
 	}
-	amountStr := fmt.Sprintf(fmt.Sprintf("%%.%df", precision), amount)
+	amountStr := fmt.Sprintf(fmt.Sprintf("%%.%df", precision), req.Amount)
 	amountStr = strings.TrimRight(amountStr, "0")
 	amountStr = strings.TrimRight(amountStr, ".")
 	finalAmount, err := strconv.ParseFloat(amountStr, 64)
 	if err != nil {
-		return fmt.Errorf("failed to parse final amount string to float (%s): %w", amountStr, err)
+		return Order{}, fmt.Errorf("failed to parse final amount string to float (%s): %w", amountStr, err)
 	}
 
 	payload := map[string]interface{}{
 		"sym": sym,
 		"amt": finalAmount,
-		"rat": rate,
-		"typ": "market",
+		"rat": req.Rate,
+		"typ": req.Type,
 	}
 
-	respBody, err := sendPrivateRequest(endpoint, "POST", payload)
+	respBody, err := b.sendPrivateRequest(b.ctx, endpoint, "POST", payload, false)
 	if err != nil {
-		return err
+		return Order{}, err
 	}
 
-	var orderResp map[string]interface{}
+	var orderResp placeOrderResponse
 	if err := json.Unmarshal(respBody, &orderResp); err != nil {
-		return fmt.Errorf("order sent to %s, but failed to decode response: %s", endpoint, string(respBody))
+		return Order{}, fmt.Errorf("order sent to %s, but failed to decode response: %s", endpoint, string(respBody))
+	}
+
+	r := orderResp.Result
+	order := Order{
+		ID:        r.ID,
+		Hash:      r.Hash,
+		Asset:     req.Asset,
+		Side:      req.Side,
+		Type:      req.Type,
+		Amount:    finalAmount,
+		Rate:      r.Rate,
+		Fee:       r.Fee,
+		Credit:    r.Credit,
+		Received:  r.Received,
+		Timestamp: time.Now(),
+	}
+	if r.Amt > 0 {
+		order.Amount = r.Amt
+	}
+	if ts, err := strconv.ParseInt(r.TS, 10, 64); err == nil {
+		order.Timestamp = time.Unix(ts, 0)
 	}
 
-	if code, ok := orderResp["error"].(float64); ok && code == 0 {
+	return order, nil
+}
+
+func (b *BitkubExchange) OrderInfo(asset string, side string, orderID string) (OrderInfo, error) {
+	query := url.Values{}
+	query.Set("sym", strings.ToLower(asset)+"_thb")
+	query.Set("id", orderID)
+	query.Set("sd", side)
+
+	respBody, err := b.sendPrivateRequest(context.WithoutCancel(b.ctx), "v3/market/order-info?"+query.Encode(), "GET", nil, true)
+	if err != nil {
+		return OrderInfo{}, err
+	}
+
+	var infoResp orderInfoResponse
+	if err := json.Unmarshal(respBody, &infoResp); err != nil {
+		return OrderInfo{}, fmt.Errorf("failed to decode order-info JSON: %v", err)
+	}
+
+	r := infoResp.Result
+	info := OrderInfo{
+		ID:        r.ID,
+		Side:      r.Side,
+		Status:    r.Status,
+		Amount:    r.Amount,
+		Filled:    r.Filled,
+		Remaining: r.Remaining,
+		Rate:      r.Rate,
+		Fee:       r.Fee,
+		AvgPrice:  r.Rate,
+	}
+
+	// The fill history carries the real execution rates; average them by amount.
+	filled, notional := 0.0, 0.0
+	for _, h := range r.History {
+		filled += h.Amount
+		notional += h.Amount * h.Rate
+		info.Credit += h.Credit
+	}
+	if filled > 0 {
+		info.AvgPrice = notional / filled
+	}
+
+	return info, nil
+}
+
+func (b *BitkubExchange) CancelOrder(asset string, side string, orderID string) error {
+	payload := map[string]interface{}{
+		"sym": strings.ToLower(asset) + "_thb",
+		"id":  orderID,
+		"sd":  side,
+	}
+
+	_, err := b.sendPrivateRequest(context.WithoutCancel(b.ctx), "v3/market/cancel-order", "POST", payload, true)
+	return err
+}
+
+// flexFloat accepts numbers that Bitkub sends either as JSON numbers or as strings.
+type flexFloat float64
+
+func (f *flexFloat) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	if s == "" || s == "null" {
+		*f = 0
 		return nil
 	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return err
+	}
+	*f = flexFloat(v)
+	return nil
+}
+
+// FiatTransfer is a THB deposit or withdrawal from Bitkub's history.
+type FiatTransfer struct {
+	TxnID  string
+	Amount float64
+	Fee    float64
+	Status string
+	Time   time.Time
+}
+
+// FiatHistory pages through the THB deposit ("deposit") or withdrawal
+// ("withdrawal") history.
+func (b *BitkubExchange) FiatHistory(kind string) ([]FiatTransfer, error) {
+	endpoint := "v3/fiat/deposit-history"
+	if kind == CashWithdrawal {
+		endpoint = "v3/fiat/withdraw-history"
+	}
+
+	transfers := []FiatTransfer{}
+	for page := 1; page <= 100; page++ {
+		query := url.Values{}
+		query.Set("p", strconv.Itoa(page))
+		query.Set("lmt", "100")
 
-	return fmt.Errorf("order to %s failed. Response: %s", endpoint, string(respBody))
+		respBody, err := b.sendPrivateRequest(b.ctx, endpoint+"?"+query.Encode(), "POST", nil, true)
+		if err != nil {
+			return nil, err
+		}
+
+		var historyResp fiatHistoryResponse
+		if err := json.Unmarshal(respBody, &historyResp); err != nil {
+			return nil, fmt.Errorf("failed to decode %s JSON: %v", endpoint, err)
+		}
+
+		for _, r := range historyResp.Result {
+			transfers = append(transfers, FiatTransfer{
+				TxnID:  r.TxnID,
+				Amount: float64(r.Amount),
+				Fee:    float64(r.Fee),
+				Status: r.Status,
+				Time:   time.Unix(r.Time, 0),
+			})
+		}
+		if len(historyResp.Result) == 0 || page >= historyResp.Pagination.Last {
+			break
+		}
+	}
+	return transfers, nil
 }
@@ -0,0 +1,77 @@
+package core
+
+import (
+	"fmt"
+	"time"
+)
+
+// Audit events.
+const (
+	AuditLoginSuccess   = "login_success"
+	AuditLoginFailure   = "login_failure"
+	AuditLoginLocked    = "login_locked"
+	AuditLogout         = "logout"
+	AuditPasswordChange = "password_change"
+	AuditModeChange     = "mode_change"
+	AuditConfigChange   = "config_change"
+	AuditConfigReload   = "config_reload"
+	AuditDCADeposit     = "dca_deposit"
+	AuditCashFlow       = "cash_flow"
+)
+
+type AuditEntry struct {
+	ID        int    `json:"id"`
+	Timestamp string `json:"timestamp"`
+	Event     string `json:"event"`
+	Username  string `json:"username"`
+	IP        string `json:"ip"`
+	UserAgent string `json:"user_agent"`
+	Detail    string `json:"detail"`
+}
+
+func Audit(event string, username string, ip string, userAgent string, detail string) {
+	if DB == nil {
+		fmt.Println("❌ Error: Database connection is nil. Cannot write audit log.")
+		return
+	}
+
+	_, err := DB.Exec(`INSERT INTO audit_log (timestamp, event, username, ip, user_agent, detail) VALUES (?, ?, ?, ?, ?, ?)`,
+		time.Now(), event, username, ip, userAgent, detail)
+	if err != nil {
+		fmt.Printf("❌ Error saving audit log: %v\n", err)
+	}
+}
+
+// GetAuditLog returns the newest entries first, optionally only one event type.
+func GetAuditLog(limit int, event string) ([]AuditEntry, error) {
+	if DB == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	query := `SELECT id, timestamp, event, username, ip, user_agent, detail FROM audit_log`
+	args := []interface{}{}
+	if event != "" {
+		query += ` WHERE event = ?`
+		args = append(args, event)
+	}
+	query += ` ORDER BY id DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var e AuditEntry
+		var ts time.Time
+		if err := rows.Scan(&e.ID, &ts, &e.Event, &e.Username, &e.IP, &e.UserAgent, &e.Detail); err != nil {
+			continue
+		}
+		e.Timestamp = ts.Format("02/01/2006 15:04:05")
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
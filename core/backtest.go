@@ -0,0 +1,383 @@
+package core
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PricePoint is one step of historical data: the close price of every asset
+// at a point in time.
+type PricePoint struct {
+	Time   time.Time
+	Prices map[string]float64
+}
+
+type BacktestConfig struct {
+	Targets     map[string]float64
+	Threshold   float64
+	InitialTHB  float64
+	FeePct      float64
+	SlippagePct float64
+	MinOrderTHB float64
+
+	// Strategy defaults to threshold rebalancing at Threshold.
+	Strategy Strategy
+}
+
+type BacktestResult struct {
+	Start         time.Time
+	End           time.Time
+	Steps         int
+	InitialValue  float64
+	FinalValue    float64
+	ROI           float64
+	MaxDrawdown   float64
+	TradedTHB     float64
+	Turnover      float64
+	TradeCount    int
+	FeesPaid      float64
+	BuyHoldValue  float64
+	FinalBalances map[string]float64
+}
+
+// SimulatedFill is the outcome of an order filled against a simulated wallet.
+type SimulatedFill struct {
+	Price      float64
+	AmountTHB  float64
+	CoinAmount float64
+	Fee        float64
+}
+
+// simulateFill fills an order against balances in place. Amount follows the
+// Exchange convention: THB for buys, coin units for sells. Slippage moves the
+// fill price against us and the fee is charged in THB.
+func simulateFill(balances map[string]float64, asset string, side string, amount float64, price float64, feePct float64, slippagePct float64) (SimulatedFill, error) {
+	if price <= 0 {
+		return SimulatedFill{}, fmt.Errorf("no price for %s", asset)
+	}
+
+	switch side {
+	case "buy":
+		spend := math.Min(amount, balances["THB"])
+		if spend <= 0 {
+			return SimulatedFill{}, fmt.Errorf("insufficient THB balance")
+		}
+		fillPrice := price * (1 + slippagePct/100.0)
+		fee := spend * feePct / 100.0
+		coins := (spend - fee) / fillPrice
+
+		balances["THB"] -= spend
+		balances[asset] += coins
+		return SimulatedFill{Price: fillPrice, AmountTHB: spend, CoinAmount: coins, Fee: fee}, nil
+	case "sell":
+		coins := math.Min(amount, balances[asset])
+		if coins <= 0 {
+			return SimulatedFill{}, fmt.Errorf("insufficient %s balance", asset)
+		}
+		fillPrice := price * (1 - slippagePct/100.0)
+		gross := coins * fillPrice
+		fee := gross * feePct / 100.0
+
+		balances[asset] -= coins
+		balances["THB"] += gross - fee
+		return SimulatedFill{Price: fillPrice, AmountTHB: gross, CoinAmount: coins, Fee: fee}, nil
+	}
+
+	return SimulatedFill{}, fmt.Errorf("invalid operation: must be 'buy' or 'sell'")
+}
+
+// RunBacktest replays the price history through BuildPortfolio and the
+// strategy, the same decision code RunRebalance uses, starting from a
+// wallet that holds only THB.
+func RunBacktest(cfg BacktestConfig, points []PricePoint) (BacktestResult, error) {
+	if len(points) == 0 {
+		return BacktestResult{}, fmt.Errorf("no price data to replay")
+	}
+	if err := ValidateTargets(cfg.Targets); err != nil {
+		return BacktestResult{}, err
+	}
+	if cfg.InitialTHB <= 0 {
+		return BacktestResult{}, fmt.Errorf("initial investment must be positive")
+	}
+
+	strategy := cfg.Strategy
+	if strategy == nil {
+		strategy = ThresholdStrategy{Threshold: cfg.Threshold, MinOrderTHB: cfg.MinOrderTHB}
+	}
+	state := StrategyState{}
+
+	balances := map[string]float64{"THB": cfg.InitialTHB}
+	prices := map[string]float64{"THB": 1.0}
+
+	result := BacktestResult{
+		Start:        points[0].Time,
+		End:          points[len(points)-1].Time,
+		Steps:        len(points),
+		InitialValue: cfg.InitialTHB,
+	}
+
+	peak := 0.0
+	valueSum := 0.0
+	var holdCoins map[string]float64
+
+	for _, point := range points {
+		for asset, price := range point.Prices {
+			prices[asset] = price
+		}
+
+		if holdCoins == nil {
+			holdCoins = buyAndHoldBasket(cfg, prices)
+		}
+
+		summary := BuildPortfolio(balances, prices, cfg.Targets, cfg.InitialTHB)
+		for _, plan := range strategy.Plan(summary, point.Time, &state) {
+			if plan.Operation == "" || plan.Skip != "" {
+				continue
+			}
+
+			fill, err := simulateFill(balances, plan.Asset, plan.Operation, plan.OrderAmount(), plan.Price, cfg.FeePct, cfg.SlippagePct)
+			if err != nil {
+				continue
+			}
+			result.TradeCount++
+			result.TradedTHB += fill.AmountTHB
+			result.FeesPaid += fill.Fee
+		}
+
+		value := portfolioValue(balances, prices)
+		valueSum += value
+		if value > peak {
+			peak = value
+		}
+		if peak > 0 {
+			result.MaxDrawdown = math.Max(result.MaxDrawdown, (peak-value)/peak*100.0)
+		}
+	}
+
+	result.FinalValue = portfolioValue(balances, prices)
+	result.ROI = (result.FinalValue - cfg.InitialTHB) / cfg.InitialTHB * 100.0
+	if avg := valueSum / float64(len(points)); avg > 0 {
+		result.Turnover = result.TradedTHB / avg
+	}
+	result.BuyHoldValue = portfolioValue(holdCoins, prices)
+	result.FinalBalances = balances
+	return result, nil
+}
+
+// buyAndHoldBasket is the benchmark: the initial THB split into the target
+// weights at the first prices (fees included) and never touched again.
+func buyAndHoldBasket(cfg BacktestConfig, prices map[string]float64) map[string]float64 {
+	basket := map[string]float64{}
+	for asset, pct := range cfg.Targets {
+		alloc := cfg.InitialTHB * pct / 100.0
+		if asset == "THB" {
+			basket["THB"] += alloc
+			continue
+		}
+		if prices[asset] <= 0 {
+			basket["THB"] += alloc
+			continue
+		}
+		fee := alloc * cfg.FeePct / 100.0
+		basket[asset] = (alloc - fee) / (prices[asset] * (1 + cfg.SlippagePct/100.0))
+	}
+	return basket
+}
+
+func portfolioValue(balances map[string]float64, prices map[string]float64) float64 {
+	total := 0.0
+	for asset, amount := range balances {
+		if asset == "THB" {
+			total += amount
+			continue
+		}
+		total += amount * prices[asset]
+	}
+	return total
+}
+
+func (r BacktestResult) Print() {
+	fmt.Printf("\n📊 Backtest %s → %s (%d steps)\n",
+		r.Start.Format("02/01/2006 15:04"), r.End.Format("02/01/2006 15:04"), r.Steps)
+	fmt.Printf("   Initial Value : %.2f THB\n", r.InitialValue)
+	fmt.Printf("   Final Value   : %.2f THB\n", r.FinalValue)
+	fmt.Printf("   ROI           : %.2f%%\n", r.ROI)
+	fmt.Printf("   Max Drawdown  : %.2f%%\n", r.MaxDrawdown)
+	fmt.Printf("   Trades        : %d\n", r.TradeCount)
+	fmt.Printf("   Traded Volume : %.2f THB\n", r.TradedTHB)
+	fmt.Printf("   Turnover      : %.2fx\n", r.Turnover)
+	fmt.Printf("   Fees Paid     : %.2f THB\n", r.FeesPaid)
+	fmt.Printf("   Buy & Hold    : %.2f THB (%.2f%%)\n", r.BuyHoldValue, (r.BuyHoldValue-r.InitialValue)/r.InitialValue*100.0)
+
+	assets := make([]string, 0, len(r.FinalBalances))
+	for asset := range r.FinalBalances {
+		assets = append(assets, asset)
+	}
+	sort.Strings(assets)
+	for _, asset := range assets {
+		fmt.Printf("   Balance %-6s: %.8f\n", asset, r.FinalBalances[asset])
+	}
+}
+
+// PrintComparison shows what trading only part of the gap saved against
+// full, the same run with every trade going all the way back to target.
+func (r BacktestResult) PrintComparison(full BacktestResult) {
+	fmt.Printf("\n✂️ Partial vs full rebalance\n")
+	fmt.Printf("   Fees Paid     : %.2f vs %.2f THB (saved %.2f THB)\n", r.FeesPaid, full.FeesPaid, full.FeesPaid-r.FeesPaid)
+	fmt.Printf("   Traded Volume : %.2f vs %.2f THB\n", r.TradedTHB, full.TradedTHB)
+	fmt.Printf("   Trades        : %d vs %d\n", r.TradeCount, full.TradeCount)
+	fmt.Printf("   Final Value   : %.2f vs %.2f THB (%+.2f THB)\n", r.FinalValue, full.FinalValue, r.FinalValue-full.FinalValue)
+}
+
+// LoadPriceCSV reads historical prices. Three layouts are accepted, chosen by
+// the header row:
+//
+//	timestamp,asset,open,high,low,close   (one row per asset per step)
+//	timestamp,open,high,low,close         (single asset, named by defaultAsset)
+//	timestamp,BTC,ETH,SOL                 (one close column per asset)
+//
+// "price" may be used instead of "close" for tick data. Timestamps may be
+// unix seconds/milliseconds, RFC 3339, "2006-01-02 15:04:05" or "2006-01-02".
+func LoadPriceCSV(path string, defaultAsset string) ([]PricePoint, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening price data: %w", err)
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("error reading CSV header: %w", err)
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	timeCol, ok := columns["timestamp"]
+	if !ok {
+		if timeCol, ok = columns["time"]; !ok {
+			if timeCol, ok = columns["date"]; !ok {
+				return nil, fmt.Errorf("CSV header must contain a timestamp, time or date column")
+			}
+		}
+	}
+
+	priceCol, hasPrice := columns["close"]
+	if !hasPrice {
+		priceCol, hasPrice = columns["price"]
+	}
+	assetCol, hasAsset := columns["asset"]
+	if !hasAsset {
+		assetCol, hasAsset = columns["symbol"]
+	}
+
+	// Wide layout: every column other than the timestamp is an asset.
+	wideCols := map[int]string{}
+	if !hasPrice {
+		for i, name := range header {
+			if i != timeCol {
+				wideCols[i] = strings.ToUpper(strings.TrimSpace(name))
+			}
+		}
+	} else if !hasAsset && defaultAsset == "" {
+		return nil, fmt.Errorf("CSV has no asset column; pass the asset symbol explicitly")
+	}
+
+	byTime := map[int64]*PricePoint{}
+	line := 1
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line++
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if timeCol >= len(record) {
+			return nil, fmt.Errorf("line %d: missing timestamp", line)
+		}
+
+		ts, err := parseTimestamp(record[timeCol])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		point, ok := byTime[ts.UnixNano()]
+		if !ok {
+			point = &PricePoint{Time: ts, Prices: map[string]float64{}}
+			byTime[ts.UnixNano()] = point
+		}
+
+		if len(wideCols) > 0 {
+			for col, asset := range wideCols {
+				if col >= len(record) || strings.TrimSpace(record[col]) == "" {
+					continue
+				}
+				price, err := strconv.ParseFloat(strings.TrimSpace(record[col]), 64)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: invalid price for %s: %q", line, asset, record[col])
+				}
+				point.Prices[asset] = price
+			}
+			continue
+		}
+
+		asset := strings.ToUpper(defaultAsset)
+		if hasAsset && assetCol < len(record) {
+			asset = normalizeAssetSymbol(record[assetCol])
+		}
+		if priceCol >= len(record) {
+			return nil, fmt.Errorf("line %d: missing price", line)
+		}
+		price, err := strconv.ParseFloat(strings.TrimSpace(record[priceCol]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid price %q", line, record[priceCol])
+		}
+		point.Prices[asset] = price
+	}
+
+	points := make([]PricePoint, 0, len(byTime))
+	for _, point := range byTime {
+		points = append(points, *point)
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].Time.Before(points[j].Time) })
+	return points, nil
+}
+
+// normalizeAssetSymbol accepts "BTC", "btc", "THB_BTC" or "BTC_THB".
+func normalizeAssetSymbol(sym string) string {
+	sym = strings.ToUpper(strings.TrimSpace(sym))
+	sym = strings.TrimPrefix(sym, "THB_")
+	sym = strings.TrimSuffix(sym, "_THB")
+	return sym
+}
+
+func parseTimestamp(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if n > 1e12 {
+			return time.UnixMilli(n), nil
+		}
+		return time.Unix(n, 0), nil
+	}
+
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02"} {
+		if ts, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return ts, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognised timestamp %q", value)
+}
@@ -0,0 +1,311 @@
+package core
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Cash flow types.
+const (
+	CashDeposit    = "deposit"
+	CashWithdrawal = "withdrawal"
+)
+
+// Where a cash flow came from. CashSourceInitial is INITIAL_INVESTMENT,
+// entered for wallets that were funded before the ledger existed.
+const (
+	CashSourceManual  = "manual"
+	CashSourceBitkub  = "bitkub"
+	CashSourceDCA     = "dca"
+	CashSourceInitial = "initial"
+)
+
+// CashFlow is money moved into or out of the portfolio, as opposed to a
+// trade inside it. Each mode has its own ledger: DRY_RUN deposits go to the
+// paper wallet.
+type CashFlow struct {
+	ID        int64     `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	Mode      string    `json:"mode"`
+	Type      string    `json:"type"`
+	AmountTHB float64   `json:"amount_thb"`
+	Source    string    `json:"source"`
+	Reference string    `json:"reference,omitempty"`
+	Note      string    `json:"note,omitempty"`
+	CreatedBy string    `json:"created_by,omitempty"`
+}
+
+// Signed is the flow from the portfolio's point of view: deposits are
+// positive, withdrawals negative.
+func (f CashFlow) Signed() float64 {
+	if f.Type == CashWithdrawal {
+		return -f.AmountTHB
+	}
+	return f.AmountTHB
+}
+
+// normalize fills in defaults and checks the entry can be recorded.
+func (f CashFlow) normalize() (CashFlow, error) {
+	if f.Type != CashDeposit && f.Type != CashWithdrawal {
+		return f, fmt.Errorf("type must be %s or %s", CashDeposit, CashWithdrawal)
+	}
+	if f.AmountTHB <= 0 || math.IsNaN(f.AmountTHB) || math.IsInf(f.AmountTHB, 0) {
+		return f, fmt.Errorf("amount must be greater than 0 THB")
+	}
+	if f.Mode != "DRY_RUN" && f.Mode != "PRODUCTION" {
+		return f, fmt.Errorf("mode must be DRY_RUN or PRODUCTION")
+	}
+	if f.Timestamp.IsZero() {
+		f.Timestamp = time.Now()
+	}
+	if f.Timestamp.After(time.Now().Add(time.Minute)) {
+		return f, fmt.Errorf("timestamp is in the future")
+	}
+	if f.Source == "" {
+		f.Source = CashSourceManual
+	}
+	return f, nil
+}
+
+// AddCashFlow validates and records a cash flow. A zero Timestamp means now.
+func AddCashFlow(f CashFlow) (CashFlow, error) {
+	if DB == nil {
+		return f, fmt.Errorf("database not initialized")
+	}
+	f, err := f.normalize()
+	if err != nil {
+		return f, err
+	}
+
+	res, err := DB.Exec(`INSERT INTO cash_flows (timestamp, mode, type, amount_thb, source, reference, note, created_by, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		f.Timestamp.Local(), f.Mode, f.Type, f.AmountTHB, f.Source, f.Reference, f.Note, f.CreatedBy, time.Now())
+	if err != nil {
+		return f, fmt.Errorf("error saving cash flow: %w", err)
+	}
+	f.ID, _ = res.LastInsertId()
+
+	invalidateReturns(f.Mode, f.Timestamp)
+	notifyPortfolioChanged()
+	fmt.Printf("💵 %s %s %.2f THB (%s)\n", f.Mode, f.Type, f.AmountTHB, f.Source)
+	return f, nil
+}
+
+// RecordCashFlow enters a deposit or withdrawal made by the user. In
+// DRY_RUN the money is also moved in or out of the paper wallet, as there is
+// no real transfer for the wallet to pick up.
+func RecordCashFlow(f CashFlow) (CashFlow, error) {
+	f, err := f.normalize()
+	if err != nil {
+		return f, err
+	}
+	if f.Mode == "DRY_RUN" {
+		// A withdrawal larger than the paper THB balance is refused.
+		if err := creditPaperWallet("THB", f.Signed()); err != nil {
+			return f, err
+		}
+	}
+	return AddCashFlow(f)
+}
+
+// DeleteCashFlow removes an entry, e.g. an INITIAL_INVESTMENT estimate that
+// an import from Bitkub has replaced. The paper wallet is left as it is.
+func DeleteCashFlow(id int64) error {
+	if DB == nil {
+		return fmt.Errorf("database not initialized")
+	}
+	var mode string
+	var ts time.Time
+	err := DB.QueryRow(`SELECT mode, timestamp FROM cash_flows WHERE id = ?`, id).Scan(&mode, &ts)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("cash flow %d not found", id)
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := DB.Exec(`DELETE FROM cash_flows WHERE id = ?`, id); err != nil {
+		return err
+	}
+	invalidateReturns(mode, ts)
+	notifyPortfolioChanged()
+	return nil
+}
+
+// ListCashFlows returns a mode's ledger, newest first. limit <= 0 returns
+// every entry.
+func ListCashFlows(mode string, limit int) ([]CashFlow, error) {
+	if DB == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+	if limit <= 0 {
+		limit = -1
+	}
+
+	rows, err := DB.Query(`SELECT id, timestamp, mode, type, amount_thb, source, COALESCE(reference, ''), COALESCE(note, ''),
+			COALESCE(created_by, '')
+		FROM cash_flows WHERE mode = ? ORDER BY timestamp DESC, id DESC LIMIT ?`, mode, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	flows := []CashFlow{}
+	for rows.Next() {
+		var f CashFlow
+		if err := rows.Scan(&f.ID, &f.Timestamp, &f.Mode, &f.Type, &f.AmountTHB, &f.Source, &f.Reference, &f.Note, &f.CreatedBy); err != nil {
+			return nil, err
+		}
+		flows = append(flows, f)
+	}
+	return flows, rows.Err()
+}
+
+// NetInvested is deposits minus withdrawals. Without any ledger entries it
+// falls back to INITIAL_INVESTMENT.
+func NetInvested(mode string) float64 {
+	flows, err := ListCashFlows(mode, 0)
+	if err != nil || len(flows) == 0 {
+		ConfigMutex.RLock()
+		defer ConfigMutex.RUnlock()
+		return InitialInvestment
+	}
+
+	net := 0.0
+	for _, f := range flows {
+		net += f.Signed()
+	}
+	return net
+}
+
+// InitCashFlows enters INITIAL_INVESTMENT as the first deposit of a ledger
+// that is still empty, dated at the mode's first trade. A DRY_RUN wallet
+// that has not been funded yet records its deposit when it is funded.
+func InitCashFlows() error {
+	ConfigMutex.RLock()
+	initial := InitialInvestment
+	ConfigMutex.RUnlock()
+	if initial <= 0 {
+		return nil
+	}
+
+	for _, mode := range []string{"PRODUCTION", "DRY_RUN"} {
+		var count int
+		if err := DB.QueryRow(`SELECT COUNT(*) FROM cash_flows WHERE mode = ?`, mode).Scan(&count); err != nil {
+			return fmt.Errorf("error reading cash flows: %w", err)
+		}
+		if count > 0 {
+			continue
+		}
+		if mode == "DRY_RUN" {
+			if err := DB.QueryRow(`SELECT COUNT(*) FROM paper_wallet`).Scan(&count); err != nil {
+				return fmt.Errorf("error reading paper wallet: %w", err)
+			}
+			if count == 0 {
+				continue
+			}
+		}
+
+		start := time.Now()
+		var first sql.NullString
+		if err := DB.QueryRow(`SELECT MIN(timestamp) FROM trades WHERE mode = ?`, mode).Scan(&first); err == nil && first.Valid {
+			if t, err := parseSQLiteTime(first.String); err == nil {
+				start = t
+			}
+		}
+
+		_, err := AddCashFlow(CashFlow{
+			Timestamp: start, Mode: mode, Type: CashDeposit, AmountTHB: initial,
+			Source: CashSourceInitial, Note: "INITIAL_INVESTMENT",
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseSQLiteTime reads a DATETIME that came back as text (MIN() loses the
+// column type, so the driver does not convert it).
+func parseSQLiteTime(s string) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02 15:04:05.999999999-07:00", "2006-01-02 15:04:05-07:00", "2006-01-02 15:04:05"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognised time %q", s)
+}
+
+// ImportBitkubCashFlows copies completed THB deposits and withdrawals from
+// Bitkub into the PRODUCTION ledger. Entries already imported are skipped.
+// A manual or DCA entry of the same type and amount within two days is
+// taken to be the same transfer and is linked to it instead of being
+// counted twice.
+func ImportBitkubCashFlows(b *BitkubExchange) (int, int, error) {
+	existing, err := ListCashFlows("PRODUCTION", 0)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	added, linked := 0, 0
+	for _, kind := range []string{CashDeposit, CashWithdrawal} {
+		history, err := b.FiatHistory(kind)
+		if err != nil {
+			return added, linked, err
+		}
+
+		for _, h := range history {
+			if h.Status != "complete" {
+				continue
+			}
+			if match := matchCashFlow(existing, kind, h); match != nil {
+				if match.Reference == "" {
+					if _, err := DB.Exec(`UPDATE cash_flows SET reference = ? WHERE id = ?`, h.TxnID, match.ID); err != nil {
+						return added, linked, fmt.Errorf("error linking cash flow: %w", err)
+					}
+					match.Reference = h.TxnID
+					linked++
+				}
+				continue
+			}
+
+			f, err := AddCashFlow(CashFlow{
+				Timestamp: h.Time, Mode: "PRODUCTION", Type: kind, AmountTHB: h.Amount,
+				Source: CashSourceBitkub, Reference: h.TxnID,
+			})
+			if err != nil {
+				return added, linked, err
+			}
+			existing = append(existing, f)
+			added++
+		}
+	}
+
+	for _, f := range existing {
+		if f.Source == CashSourceInitial && added > 0 {
+			fmt.Printf("⚠️ Cash flow %d is the INITIAL_INVESTMENT estimate; delete it if the imported deposits already cover it\n", f.ID)
+		}
+	}
+	return added, linked, nil
+}
+
+func matchCashFlow(flows []CashFlow, kind string, h FiatTransfer) *CashFlow {
+	for i := range flows {
+		f := &flows[i]
+		if f.Reference == h.TxnID {
+			return f
+		}
+	}
+	for i := range flows {
+		f := &flows[i]
+		if f.Reference != "" || f.Type != kind || f.Source == CashSourceInitial {
+			continue
+		}
+		if math.Abs(f.AmountTHB-h.Amount) < 0.01 && math.Abs(f.Timestamp.Sub(h.Time).Hours()) <= 48 {
+			return f
+		}
+	}
+	return nil
+}
@@ -2,9 +2,13 @@ package core
 
 import (
 	"fmt"
+	"math"
 	"os"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
 var (
@@ -13,46 +17,190 @@ var (
 	IsDryRun          bool
 	InitialInvestment float64
 	Threshold         float64
-	CoinAsset         string
 	DiscordWebhookURL string
 	APIUrl            string
 
+	// Bitkub REST calls: APITimeout bounds one attempt, idempotent calls are
+	// retried up to APIMaxRetries times and at most APIMaxConcurrent run at
+	// once. See httpclient.go.
+	APITimeout       = 10 * time.Second
+	APIMaxRetries    = 3
+	APIMaxConcurrent = 4
+
 	TargetAssets map[string]float64
+
+	// MinOrderTHB is the smallest order, buy or sell, the bot sends (Bitkub's
+	// minimum is 10 THB).
+	MinOrderTHB = 10.0
+
+	// RebalanceInterval is how long the bot waits between rebalance checks.
+	RebalanceInterval = 1 * time.Minute
+
+	// RebalanceSchedule can replace the interval with cron times and pause
+	// checks during blackout windows.
+	RebalanceSchedule = &Schedule{Location: time.Local}
+
+	// Order execution. OrderType "limit" places limit orders LimitOffsetPct
+	// away from the best ask (buys) or bid (sells); a positive offset crosses
+	// the spread, a negative one rests inside the book.
+	OrderType           = "market"
+	LimitOffsetPct      = 0.1
+	LimitTimeout        = 30 * time.Second
+	LimitPollInterval   = 3 * time.Second
+	LimitMaxReprices    = 2
+	LimitMaxSlippagePct = 1.0
+
+	// Fees and slippage applied to DRY_RUN fills on the paper wallet.
+	PaperFeePct      = 0.25
+	PaperSlippagePct = 0.0
+
+	// Strategy picks which deviations trigger a trade; see strategy.go.
+	StrategyType    = StrategyThreshold
+	StrategyPeriod  = "monthly"
+	StrategyBandPct = 25.0
+
+	// RebalanceSizing is how much of the gap a trade closes: full, band
+	// (back to the band edge) or fraction (RebalanceFraction of the gap).
+	RebalanceSizing   = SizingFull
+	RebalanceFraction = 0.5
+
+	// DCA invests deposits gradually: DCAMode "fixed" buys DCAAmountTHB
+	// every DCAPeriod, "split" spreads each deposit over DCAPeriods periods.
+	DCAMode      = DCAOff
+	DCAPeriod    = "monthly"
+	DCAAmountTHB = 0.0
+	DCAPeriods   = 4
+
+	// Risk limits. MaxOrderTHB caps a single order (0 = no cap) and
+	// MaxTradesPerRun caps the orders sent per rebalance check (0 = no cap).
+	MaxOrderTHB     = 0.0
+	MaxTradesPerRun = 0
+
+	// MarketCacheTTL is how long balances and prices fetched by the bot loop
+	// are served to the dashboard before they count as stale. The loop
+	// refreshes them at this interval.
+	MarketCacheTTL = 15 * time.Second
+
+	// Live prices from Bitkub's public WebSocket streams. MarketWSHeartbeat is
+	// the ping interval; a connection silent for three of them is replaced.
+	// MoveTriggerPct (0 = off) runs an early rebalance check when a price
+	// moves that much since the last check.
+	MarketWSEnabled   = false
+	MarketWSURL       = "wss://api.bitkub.com/websocket-api"
+	MarketWSHeartbeat = 30 * time.Second
+	MoveTriggerPct    = 0.0
 )
 
 var ConfigMutex sync.RWMutex
 
-func LoadConfig() {
-	APIKey = os.Getenv("BITKUB_API_KEY")
-	APISecret = os.Getenv("BITKUB_API_SECRET")
-	DiscordWebhookURL = os.Getenv("DISCORD_WEBHOOK_URL")
-	APIUrl = os.Getenv("BITKUB_API_BASE_URL")
-	CoinAsset = os.Getenv("ASSET_SYMBOLS")
+// LoadConfig resolves the config from the optional CONFIG_FILE and env vars
+// and applies it. Nothing is applied when any value is invalid; the returned
+// ConfigErrors lists every problem.
+func LoadConfig() error {
+	cfg, err := BuildConfig(os.Getenv("CONFIG_FILE"))
+	if err != nil {
+		return err
+	}
+	cfg.apply()
+
+	mode := "PRODUCTION"
+	if cfg.DryRun {
+		mode = "DRY_RUN"
+	}
+	fmt.Printf("✅ Config loaded. Mode: %s, Initial Inv: %.2f THB, Targets: %s\n",
+		mode, cfg.InitialInvestment, FormatTargets(cfg.Targets))
+	return nil
+}
+
+// ParseTargetWeights builds the target allocation from TARGET_WEIGHTS
+// ("THB:40,BTC:30,ETH:20,SOL:10"). When it is empty, THB keeps 50% and the
+// remaining 50% is split evenly across the coins listed in ASSET_SYMBOLS.
+func ParseTargetWeights(weights string, symbols string) (map[string]float64, error) {
+	targets := make(map[string]float64)
 
-	if APIKey == "" || APISecret == "" {
-        panic("❌ Error fetching wallet balance: API Keys not configured. Please check config.go")        
-    }
+	if strings.TrimSpace(weights) == "" {
+		coins := []string{}
+		for _, sym := range strings.Split(symbols, ",") {
+			sym = strings.ToUpper(strings.TrimSpace(sym))
+			if sym != "" && sym != "THB" {
+				coins = append(coins, sym)
+			}
+		}
+		if len(coins) == 0 {
+			return nil, fmt.Errorf("ASSET_SYMBOLS or TARGET_WEIGHTS must list at least one coin")
+		}
 
-	IsDryRun, _ = strconv.ParseBool(os.Getenv("IS_DRY_RUN"))
+		targets["THB"] = 50.0
+		for _, coin := range coins {
+			targets[coin] = 50.0 / float64(len(coins))
+		}
+		return targets, nil
+	}
 
-	if val, err := strconv.ParseFloat(os.Getenv("INITIAL_INVESTMENT"), 64); err == nil {
-		InitialInvestment = val
+	for _, entry := range strings.Split(weights, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid weight %q: expected ASSET:PERCENT", entry)
+		}
+		asset := strings.ToUpper(strings.TrimSpace(parts[0]))
+		pct, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+		if err != nil || pct < 0 {
+			return nil, fmt.Errorf("invalid percentage for %s: %q", asset, parts[1])
+		}
+		if _, exists := targets[asset]; exists {
+			return nil, fmt.Errorf("asset %s is listed more than once", asset)
+		}
+		targets[asset] = pct
 	}
 
-	if val, err := strconv.ParseFloat(os.Getenv("THRESHOLD_PERCENTAGE"), 64); err == nil {
-		Threshold = val
+	if err := ValidateTargets(targets); err != nil {
+		return nil, err
+	}
+	if _, ok := targets["THB"]; !ok {
+		targets["THB"] = 0.0
 	}
+	return targets, nil
+}
 
-	TargetAssets = make(map[string]float64)
-	TargetAssets["THB"] = 50.0
-	TargetAssets[CoinAsset] = 50.0
+// ValidateTargets checks that a target allocation has at least one coin and
+// that its weights add up to 100%.
+func ValidateTargets(targets map[string]float64) error {
+	if len(coinAssetsOf(targets)) == 0 {
+		return fmt.Errorf("target weights must include at least one coin besides THB")
+	}
 
-	fmt.Printf("✅ Config loaded. Mode: %s, Initial Inv: %.2f THB\n",
-		func() string {
-			if IsDryRun {
-				return "DRY_RUN"
-			} else {
-				return "PRODUCTION"
-			}
-		}(), InitialInvestment)
+	sum := 0.0
+	for _, pct := range targets {
+		sum += pct
+	}
+	if math.Abs(sum-100.0) > 0.0001 {
+		return fmt.Errorf("target weights must sum to 100%% (got %.4f%%)", sum)
+	}
+	return nil
+}
+
+func coinAssetsOf(targets map[string]float64) []string {
+	coins := []string{}
+	for asset := range targets {
+		if asset != "THB" {
+			coins = append(coins, asset)
+		}
+	}
+	sort.Strings(coins)
+	return coins
+}
+
+func FormatTargets(targets map[string]float64) string {
+	parts := []string{}
+	if pct, ok := targets["THB"]; ok {
+		parts = append(parts, fmt.Sprintf("THB %.2f%%", pct))
+	}
+	for _, coin := range coinAssetsOf(targets) {
+		parts = append(parts, fmt.Sprintf("%s %.2f%%", coin, targets[coin]))
+	}
+	return strings.Join(parts, " / ")
 }
@@ -0,0 +1,698 @@
+package core
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-yaml"
+)
+
+// FileConfig mirrors the optional YAML config file (CONFIG_FILE). Pointer
+// fields tell "not set" apart from zero so defaults and env vars can fill
+// the gaps. See config.example.yaml.
+type FileConfig struct {
+	DryRun            *bool              `yaml:"dry_run"`
+	InitialInvestment *float64           `yaml:"initial_investment"`
+	Assets            map[string]float64 `yaml:"assets"`
+
+	Bitkub struct {
+		APIKey         string `yaml:"api_key"`
+		APISecret      string `yaml:"api_secret"`
+		BaseURL        string `yaml:"base_url"`
+		TimeoutSeconds *int   `yaml:"timeout_seconds"`
+		MaxRetries     *int   `yaml:"max_retries"`
+		MaxConcurrent  *int   `yaml:"max_concurrent"`
+	} `yaml:"bitkub"`
+
+	Rebalance struct {
+		ThresholdPct *float64 `yaml:"threshold_pct"`
+		MinOrderTHB  *float64 `yaml:"min_order_thb"`
+		Sizing       string   `yaml:"sizing"`
+		Fraction     *float64 `yaml:"fraction"`
+	} `yaml:"rebalance"`
+
+	Schedule struct {
+		IntervalSeconds *int     `yaml:"interval_seconds"`
+		Cron            string   `yaml:"cron"`
+		Timezone        string   `yaml:"timezone"`
+		Blackouts       []string `yaml:"blackouts"`
+	} `yaml:"schedule"`
+
+	Strategy struct {
+		Type    string   `yaml:"type"`
+		Period  string   `yaml:"period"`
+		BandPct *float64 `yaml:"band_pct"`
+	} `yaml:"strategy"`
+
+	DCA struct {
+		Mode      string   `yaml:"mode"`
+		Period    string   `yaml:"period"`
+		AmountTHB *float64 `yaml:"amount_thb"`
+		Periods   *int     `yaml:"periods"`
+	} `yaml:"dca"`
+
+	Orders struct {
+		Type                string   `yaml:"type"`
+		LimitOffsetPct      *float64 `yaml:"limit_offset_pct"`
+		LimitTimeoutSeconds *int     `yaml:"limit_timeout_seconds"`
+		LimitPollSeconds    *int     `yaml:"limit_poll_seconds"`
+		LimitMaxReprices    *int     `yaml:"limit_max_reprices"`
+		LimitMaxSlippagePct *float64 `yaml:"limit_max_slippage_pct"`
+	} `yaml:"orders"`
+
+	Paper struct {
+		FeePct      *float64 `yaml:"fee_pct"`
+		SlippagePct *float64 `yaml:"slippage_pct"`
+	} `yaml:"paper"`
+
+	Notifiers struct {
+		Discord struct {
+			WebhookURL string `yaml:"webhook_url"`
+		} `yaml:"discord"`
+	} `yaml:"notifiers"`
+
+	Risk struct {
+		MaxOrderTHB     *float64 `yaml:"max_order_thb"`
+		MaxTradesPerRun *int     `yaml:"max_trades_per_run"`
+	} `yaml:"risk"`
+
+	MarketData struct {
+		CacheTTLSeconds  *int     `yaml:"cache_ttl_seconds"`
+		WebSocket        *bool    `yaml:"websocket"`
+		WebSocketURL     string   `yaml:"websocket_url"`
+		HeartbeatSeconds *int     `yaml:"heartbeat_seconds"`
+		MoveTriggerPct   *float64 `yaml:"move_trigger_pct"`
+	} `yaml:"market_data"`
+}
+
+// Config is the fully resolved configuration before it is applied to the
+// package globals.
+type Config struct {
+	APIKey            string
+	APISecret         string
+	APIUrl            string
+	DiscordWebhookURL string
+
+	APITimeout       time.Duration
+	APIMaxRetries    int
+	APIMaxConcurrent int
+
+	DryRun            bool
+	InitialInvestment float64
+	Targets           map[string]float64
+	Threshold         float64
+	RebalanceInterval time.Duration
+	MinOrderTHB       float64
+
+	ScheduleCron      string
+	ScheduleTimezone  string
+	ScheduleBlackouts []string
+
+	StrategyType    string
+	StrategyPeriod  string
+	StrategyBandPct float64
+
+	RebalanceSizing   string
+	RebalanceFraction float64
+
+	DCAMode      string
+	DCAPeriod    string
+	DCAAmountTHB float64
+	DCAPeriods   int
+
+	OrderType           string
+	LimitOffsetPct      float64
+	LimitTimeout        time.Duration
+	LimitPollInterval   time.Duration
+	LimitMaxReprices    int
+	LimitMaxSlippagePct float64
+
+	PaperFeePct      float64
+	PaperSlippagePct float64
+
+	MaxOrderTHB     float64
+	MaxTradesPerRun int
+
+	MarketCacheTTL    time.Duration
+	MarketWSEnabled   bool
+	MarketWSURL       string
+	MarketWSHeartbeat time.Duration
+	MoveTriggerPct    float64
+}
+
+// ConfigErrors collects every problem found while loading the config so
+// they can all be fixed in one go.
+type ConfigErrors []error
+
+func (e ConfigErrors) Error() string {
+	lines := make([]string, len(e))
+	for i, err := range e {
+		lines[i] = "  - " + err.Error()
+	}
+	return fmt.Sprintf("%d config error(s):\n%s", len(e), strings.Join(lines, "\n"))
+}
+
+func (e *ConfigErrors) add(format string, args ...interface{}) {
+	*e = append(*e, fmt.Errorf(format, args...))
+}
+
+func DefaultConfig() Config {
+	return Config{
+		APIUrl:              "https://api.bitkub.com/api",
+		APITimeout:          10 * time.Second,
+		APIMaxRetries:       3,
+		APIMaxConcurrent:    4,
+		StrategyType:        StrategyThreshold,
+		StrategyPeriod:      "monthly",
+		StrategyBandPct:     25.0,
+		RebalanceSizing:     SizingFull,
+		RebalanceFraction:   0.5,
+		DCAMode:             DCAOff,
+		DCAPeriod:           "monthly",
+		DCAPeriods:          4,
+		RebalanceInterval:   1 * time.Minute,
+		MinOrderTHB:         10.0,
+		OrderType:           "market",
+		LimitOffsetPct:      0.1,
+		LimitTimeout:        30 * time.Second,
+		LimitPollInterval:   3 * time.Second,
+		LimitMaxReprices:    2,
+		LimitMaxSlippagePct: 1.0,
+		PaperFeePct:         0.25,
+		MarketCacheTTL:      15 * time.Second,
+		MarketWSURL:         "wss://api.bitkub.com/websocket-api",
+		MarketWSHeartbeat:   30 * time.Second,
+	}
+}
+
+// ReadConfigFile parses a YAML config file. Unknown keys are rejected so a
+// typo does not silently fall back to a default.
+func ReadConfigFile(path string) (*FileConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file FileConfig
+	if err := yaml.UnmarshalWithOptions(data, &file, yaml.DisallowUnknownField()); err != nil {
+		return nil, fmt.Errorf("%s:\n%s", path, yaml.FormatError(err, false, true))
+	}
+	return &file, nil
+}
+
+// BuildConfig resolves the config from defaults, then the config file (if
+// path is not empty), then env vars, and validates the result. Every
+// problem is reported in the returned ConfigErrors.
+func BuildConfig(path string) (Config, error) {
+	cfg := DefaultConfig()
+	var errs ConfigErrors
+
+	if path != "" {
+		file, err := ReadConfigFile(path)
+		if err != nil {
+			errs.add("config file: %v", err)
+		} else {
+			cfg.applyFile(file)
+			warnEnvOverrides(path)
+		}
+	}
+
+	cfg.applyEnv(&errs)
+
+	blackouts := []string{}
+	for _, window := range cfg.ScheduleBlackouts {
+		if window = strings.TrimSpace(window); window != "" {
+			blackouts = append(blackouts, window)
+		}
+	}
+	cfg.ScheduleBlackouts = blackouts
+	errs = append(errs, cfg.Validate()...)
+
+	if len(errs) > 0 {
+		return cfg, errs
+	}
+	return cfg, nil
+}
+
+func (c *Config) applyFile(f *FileConfig) {
+	setString(&c.APIKey, f.Bitkub.APIKey)
+	setString(&c.APISecret, f.Bitkub.APISecret)
+	setString(&c.APIUrl, f.Bitkub.BaseURL)
+	setSeconds(&c.APITimeout, f.Bitkub.TimeoutSeconds)
+	setValue(&c.APIMaxRetries, f.Bitkub.MaxRetries)
+	setValue(&c.APIMaxConcurrent, f.Bitkub.MaxConcurrent)
+	setString(&c.DiscordWebhookURL, f.Notifiers.Discord.WebhookURL)
+	setString(&c.OrderType, strings.ToLower(f.Orders.Type))
+	setString(&c.StrategyType, strings.ToLower(f.Strategy.Type))
+	setString(&c.StrategyPeriod, strings.ToLower(f.Strategy.Period))
+	setValue(&c.StrategyBandPct, f.Strategy.BandPct)
+	setString(&c.RebalanceSizing, strings.ToLower(f.Rebalance.Sizing))
+	setValue(&c.RebalanceFraction, f.Rebalance.Fraction)
+	setString(&c.DCAMode, strings.ToLower(f.DCA.Mode))
+	setString(&c.DCAPeriod, strings.ToLower(f.DCA.Period))
+	setValue(&c.DCAAmountTHB, f.DCA.AmountTHB)
+	setValue(&c.DCAPeriods, f.DCA.Periods)
+	setString(&c.ScheduleCron, f.Schedule.Cron)
+	setString(&c.ScheduleTimezone, f.Schedule.Timezone)
+	if f.Schedule.Blackouts != nil {
+		c.ScheduleBlackouts = f.Schedule.Blackouts
+	}
+
+	setValue(&c.DryRun, f.DryRun)
+	setValue(&c.InitialInvestment, f.InitialInvestment)
+	setValue(&c.Threshold, f.Rebalance.ThresholdPct)
+	setValue(&c.MinOrderTHB, f.Rebalance.MinOrderTHB)
+	setSeconds(&c.RebalanceInterval, f.Schedule.IntervalSeconds)
+
+	setValue(&c.LimitOffsetPct, f.Orders.LimitOffsetPct)
+	setSeconds(&c.LimitTimeout, f.Orders.LimitTimeoutSeconds)
+	setSeconds(&c.LimitPollInterval, f.Orders.LimitPollSeconds)
+	setValue(&c.LimitMaxReprices, f.Orders.LimitMaxReprices)
+	setValue(&c.LimitMaxSlippagePct, f.Orders.LimitMaxSlippagePct)
+
+	setValue(&c.PaperFeePct, f.Paper.FeePct)
+	setValue(&c.PaperSlippagePct, f.Paper.SlippagePct)
+
+	setValue(&c.MaxOrderTHB, f.Risk.MaxOrderTHB)
+	setValue(&c.MaxTradesPerRun, f.Risk.MaxTradesPerRun)
+
+	setSeconds(&c.MarketCacheTTL, f.MarketData.CacheTTLSeconds)
+	setValue(&c.MarketWSEnabled, f.MarketData.WebSocket)
+	setString(&c.MarketWSURL, f.MarketData.WebSocketURL)
+	setSeconds(&c.MarketWSHeartbeat, f.MarketData.HeartbeatSeconds)
+	setValue(&c.MoveTriggerPct, f.MarketData.MoveTriggerPct)
+
+	if len(f.Assets) > 0 {
+		targets := make(map[string]float64, len(f.Assets))
+		for asset, pct := range f.Assets {
+			targets[normalizeAssetSymbol(asset)] = pct
+		}
+		if _, ok := targets["THB"]; !ok {
+			targets["THB"] = 0.0
+		}
+		c.Targets = targets
+	}
+}
+
+// envFileKeys pairs every env var with the config file key it overrides.
+var envFileKeys = [][2]string{
+	{"BITKUB_API_KEY", "bitkub.api_key"},
+	{"BITKUB_API_SECRET", "bitkub.api_secret"},
+	{"BITKUB_API_BASE_URL", "bitkub.base_url"},
+	{"BITKUB_TIMEOUT_SECONDS", "bitkub.timeout_seconds"},
+	{"BITKUB_MAX_RETRIES", "bitkub.max_retries"},
+	{"BITKUB_MAX_CONCURRENT", "bitkub.max_concurrent"},
+	{"DISCORD_WEBHOOK_URL", "notifiers.discord.webhook_url"},
+	{"IS_DRY_RUN", "dry_run"},
+	{"INITIAL_INVESTMENT", "initial_investment"},
+	{"TARGET_WEIGHTS", "assets"},
+	{"ASSET_SYMBOLS", "assets"},
+	{"THRESHOLD_PERCENTAGE", "rebalance.threshold_pct"},
+	{"MIN_ORDER_THB", "rebalance.min_order_thb"},
+	{"REBALANCE_SIZING", "rebalance.sizing"},
+	{"REBALANCE_FRACTION", "rebalance.fraction"},
+	{"REBALANCE_INTERVAL_SECONDS", "schedule.interval_seconds"},
+	{"SCHEDULE_CRON", "schedule.cron"},
+	{"SCHEDULE_TIMEZONE", "schedule.timezone"},
+	{"SCHEDULE_BLACKOUTS", "schedule.blackouts"},
+	{"STRATEGY", "strategy.type"},
+	{"STRATEGY_PERIOD", "strategy.period"},
+	{"STRATEGY_BAND_PCT", "strategy.band_pct"},
+	{"DCA_MODE", "dca.mode"},
+	{"DCA_PERIOD", "dca.period"},
+	{"DCA_AMOUNT_THB", "dca.amount_thb"},
+	{"DCA_PERIODS", "dca.periods"},
+	{"ORDER_TYPE", "orders.type"},
+	{"LIMIT_OFFSET_PCT", "orders.limit_offset_pct"},
+	{"LIMIT_TIMEOUT_SECONDS", "orders.limit_timeout_seconds"},
+	{"LIMIT_POLL_SECONDS", "orders.limit_poll_seconds"},
+	{"LIMIT_MAX_REPRICES", "orders.limit_max_reprices"},
+	{"LIMIT_MAX_SLIPPAGE_PCT", "orders.limit_max_slippage_pct"},
+	{"PAPER_FEE_PCT", "paper.fee_pct"},
+	{"PAPER_SLIPPAGE_PCT", "paper.slippage_pct"},
+	{"MAX_ORDER_THB", "risk.max_order_thb"},
+	{"MAX_TRADES_PER_RUN", "risk.max_trades_per_run"},
+	{"MARKET_CACHE_TTL_SECONDS", "market_data.cache_ttl_seconds"},
+	{"MARKET_WS_ENABLED", "market_data.websocket"},
+	{"MARKET_WS_URL", "market_data.websocket_url"},
+	{"MARKET_WS_HEARTBEAT_SECONDS", "market_data.heartbeat_seconds"},
+	{"MOVE_TRIGGER_PCT", "market_data.move_trigger_pct"},
+}
+
+// warnEnvOverrides points out env vars that hide a value set in the config
+// file. Setups that moved to a file often still have the old .env lines,
+// and then editing the file (or reloading it) silently changes nothing.
+func warnEnvOverrides(path string) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	var tree map[string]interface{}
+	if err := yaml.Unmarshal(data, &tree); err != nil {
+		return
+	}
+
+	for _, pair := range envFileKeys {
+		env, key := pair[0], pair[1]
+		if os.Getenv(env) == "" || !hasFileKey(tree, key) {
+			continue
+		}
+		fmt.Printf("⚠️ Config: %s overrides %s from %s; remove it from the environment (.env) for the file value to apply\n", env, key, path)
+	}
+}
+
+// hasFileKey reports whether a dotted key such as "rebalance.threshold_pct"
+// is set to something other than null.
+func hasFileKey(tree map[string]interface{}, key string) bool {
+	head, rest, nested := strings.Cut(key, ".")
+	val, ok := tree[head]
+	if !ok || val == nil {
+		return false
+	}
+	if !nested {
+		return true
+	}
+	sub, ok := val.(map[string]interface{})
+	return ok && hasFileKey(sub, rest)
+}
+
+// discordPlaceholder is the webhook value older .env.example files shipped
+// with; a copied example is treated as "no webhook".
+const discordPlaceholder = "your_discord_webhook_url_here"
+
+// applyEnv lets env vars override the file. A value that does not parse is
+// an error rather than being ignored.
+func (c *Config) applyEnv(errs *ConfigErrors) {
+	envString("BITKUB_API_KEY", &c.APIKey)
+	envString("BITKUB_API_SECRET", &c.APISecret)
+	envString("BITKUB_API_BASE_URL", &c.APIUrl)
+	envSeconds("BITKUB_TIMEOUT_SECONDS", &c.APITimeout, errs)
+	envInt("BITKUB_MAX_RETRIES", &c.APIMaxRetries, errs)
+	envInt("BITKUB_MAX_CONCURRENT", &c.APIMaxConcurrent, errs)
+	envString("DISCORD_WEBHOOK_URL", &c.DiscordWebhookURL)
+	if c.DiscordWebhookURL == discordPlaceholder {
+		fmt.Println("⚠️ Config: DISCORD_WEBHOOK_URL is still the example placeholder, Discord notifications are off")
+		c.DiscordWebhookURL = ""
+	}
+	if val := os.Getenv("ORDER_TYPE"); val != "" {
+		c.OrderType = strings.ToLower(val)
+	}
+	if val := os.Getenv("STRATEGY"); val != "" {
+		c.StrategyType = strings.ToLower(val)
+	}
+	if val := os.Getenv("STRATEGY_PERIOD"); val != "" {
+		c.StrategyPeriod = strings.ToLower(val)
+	}
+	envFloat("STRATEGY_BAND_PCT", &c.StrategyBandPct, errs)
+	if val := os.Getenv("REBALANCE_SIZING"); val != "" {
+		c.RebalanceSizing = strings.ToLower(val)
+	}
+	envFloat("REBALANCE_FRACTION", &c.RebalanceFraction, errs)
+	if val := os.Getenv("DCA_MODE"); val != "" {
+		c.DCAMode = strings.ToLower(val)
+	}
+	if val := os.Getenv("DCA_PERIOD"); val != "" {
+		c.DCAPeriod = strings.ToLower(val)
+	}
+	envFloat("DCA_AMOUNT_THB", &c.DCAAmountTHB, errs)
+	envInt("DCA_PERIODS", &c.DCAPeriods, errs)
+	envString("SCHEDULE_CRON", &c.ScheduleCron)
+	envString("SCHEDULE_TIMEZONE", &c.ScheduleTimezone)
+	if val := os.Getenv("SCHEDULE_BLACKOUTS"); val != "" {
+		c.ScheduleBlackouts = strings.Split(val, ";")
+	}
+
+	envBool("IS_DRY_RUN", &c.DryRun, errs)
+	envFloat("INITIAL_INVESTMENT", &c.InitialInvestment, errs)
+	envFloat("THRESHOLD_PERCENTAGE", &c.Threshold, errs)
+	envSeconds("REBALANCE_INTERVAL_SECONDS", &c.RebalanceInterval, errs)
+	envFloat("MIN_ORDER_THB", &c.MinOrderTHB, errs)
+
+	envFloat("LIMIT_OFFSET_PCT", &c.LimitOffsetPct, errs)
+	envSeconds("LIMIT_TIMEOUT_SECONDS", &c.LimitTimeout, errs)
+	envSeconds("LIMIT_POLL_SECONDS", &c.LimitPollInterval, errs)
+	envInt("LIMIT_MAX_REPRICES", &c.LimitMaxReprices, errs)
+	envFloat("LIMIT_MAX_SLIPPAGE_PCT", &c.LimitMaxSlippagePct, errs)
+
+	envFloat("PAPER_FEE_PCT", &c.PaperFeePct, errs)
+	envFloat("PAPER_SLIPPAGE_PCT", &c.PaperSlippagePct, errs)
+
+	envFloat("MAX_ORDER_THB", &c.MaxOrderTHB, errs)
+	envInt("MAX_TRADES_PER_RUN", &c.MaxTradesPerRun, errs)
+
+	envSeconds("MARKET_CACHE_TTL_SECONDS", &c.MarketCacheTTL, errs)
+	envBool("MARKET_WS_ENABLED", &c.MarketWSEnabled, errs)
+	envString("MARKET_WS_URL", &c.MarketWSURL)
+	envSeconds("MARKET_WS_HEARTBEAT_SECONDS", &c.MarketWSHeartbeat, errs)
+	envFloat("MOVE_TRIGGER_PCT", &c.MoveTriggerPct, errs)
+
+	weights, symbols := os.Getenv("TARGET_WEIGHTS"), os.Getenv("ASSET_SYMBOLS")
+	if weights != "" || symbols != "" || c.Targets == nil {
+		targets, err := ParseTargetWeights(weights, symbols)
+		if err != nil {
+			errs.add("target weights: %v", err)
+			return
+		}
+		c.Targets = targets
+	}
+}
+
+// Validate returns every problem with the config, not just the first.
+func (c Config) Validate() []error {
+	var errs ConfigErrors
+
+	if c.APIKey == "" {
+		errs.add("BITKUB_API_KEY (bitkub.api_key) is required")
+	}
+	if c.APISecret == "" {
+		errs.add("BITKUB_API_SECRET (bitkub.api_secret) is required")
+	}
+	if u, err := url.Parse(c.APIUrl); err != nil || u.Scheme == "" || u.Host == "" {
+		errs.add("BITKUB_API_BASE_URL (bitkub.base_url) %q is not a valid URL", c.APIUrl)
+	}
+	if c.APITimeout < time.Second {
+		errs.add("BITKUB_TIMEOUT_SECONDS (bitkub.timeout_seconds) must be at least 1")
+	}
+	if c.APIMaxRetries < 0 || c.APIMaxRetries > maxAPIRetries {
+		errs.add("BITKUB_MAX_RETRIES (bitkub.max_retries) must be between 0 and %d", maxAPIRetries)
+	}
+	if c.APIMaxConcurrent < 1 {
+		errs.add("BITKUB_MAX_CONCURRENT (bitkub.max_concurrent) must be at least 1")
+	}
+	if c.DiscordWebhookURL != "" && !strings.HasPrefix(c.DiscordWebhookURL, "https://") {
+		errs.add("DISCORD_WEBHOOK_URL (notifiers.discord.webhook_url) must start with https://")
+	}
+
+	if c.Targets != nil {
+		if err := ValidateTargets(c.Targets); err != nil {
+			errs.add("target weights: %v", err)
+		}
+		for _, asset := range coinAssetsOf(c.Targets) {
+			if c.Targets[asset] < 0 {
+				errs.add("target weight for %s must not be negative", asset)
+			}
+		}
+	}
+
+	if c.InitialInvestment < 0 {
+		errs.add("INITIAL_INVESTMENT (initial_investment) must not be negative")
+	}
+	if c.Threshold <= 0 {
+		errs.add("THRESHOLD_PERCENTAGE (rebalance.threshold_pct) must be greater than 0, otherwise every check trades")
+	}
+	if c.RebalanceInterval < 10*time.Second {
+		errs.add("REBALANCE_INTERVAL_SECONDS (schedule.interval_seconds) must be at least 10")
+	}
+	if c.MinOrderTHB < 10 {
+		errs.add("MIN_ORDER_THB (rebalance.min_order_thb) must be at least 10 (Bitkub's minimum)")
+	}
+	if _, err := NewSchedule(c.ScheduleCron, c.ScheduleTimezone, c.ScheduleBlackouts); err != nil {
+		errs.add("schedule (SCHEDULE_CRON / SCHEDULE_TIMEZONE / SCHEDULE_BLACKOUTS): %v", err)
+	}
+
+	if err := (Sizing{Mode: c.RebalanceSizing, Fraction: c.RebalanceFraction}).validate(); err != nil {
+		errs.add("REBALANCE_SIZING / REBALANCE_FRACTION (rebalance.sizing / rebalance.fraction): %v", err)
+	} else if _, err := NewStrategy(c.strategyConfig(), c.Threshold, c.MinOrderTHB, nil); err != nil {
+		errs.add("strategy (STRATEGY / STRATEGY_PERIOD / STRATEGY_BAND_PCT): %v", err)
+	}
+
+	if err := validateDCA(c.DCAMode, c.DCAPeriod, c.DCAAmountTHB, c.DCAPeriods, c.MinOrderTHB); err != nil {
+		errs.add("DCA (DCA_MODE / DCA_PERIOD / DCA_AMOUNT_THB / DCA_PERIODS): %v", err)
+	}
+
+	if c.OrderType != "market" && c.OrderType != "limit" {
+		errs.add("ORDER_TYPE (orders.type) must be market or limit, got %q", c.OrderType)
+	}
+	if c.LimitTimeout <= 0 {
+		errs.add("LIMIT_TIMEOUT_SECONDS (orders.limit_timeout_seconds) must be greater than 0")
+	}
+	if c.LimitPollInterval <= 0 {
+		errs.add("LIMIT_POLL_SECONDS (orders.limit_poll_seconds) must be greater than 0")
+	} else if c.LimitPollInterval > c.LimitTimeout {
+		errs.add("LIMIT_POLL_SECONDS must not be longer than LIMIT_TIMEOUT_SECONDS")
+	}
+	if c.LimitMaxReprices < 0 {
+		errs.add("LIMIT_MAX_REPRICES (orders.limit_max_reprices) must not be negative")
+	}
+	if c.LimitMaxSlippagePct <= 0 {
+		errs.add("LIMIT_MAX_SLIPPAGE_PCT (orders.limit_max_slippage_pct) must be greater than 0")
+	}
+
+	if c.PaperFeePct < 0 || c.PaperSlippagePct < 0 {
+		errs.add("PAPER_FEE_PCT and PAPER_SLIPPAGE_PCT (paper.*) must not be negative")
+	}
+
+	if c.MaxOrderTHB < 0 {
+		errs.add("MAX_ORDER_THB (risk.max_order_thb) must not be negative")
+	} else if c.MaxOrderTHB > 0 && c.MaxOrderTHB < c.MinOrderTHB {
+		errs.add("MAX_ORDER_THB (risk.max_order_thb) must be 0 (no limit) or at least MIN_ORDER_THB")
+	}
+	if c.MaxTradesPerRun < 0 {
+		errs.add("MAX_TRADES_PER_RUN (risk.max_trades_per_run) must not be negative")
+	}
+	if c.MarketCacheTTL < time.Second {
+		errs.add("MARKET_CACHE_TTL_SECONDS (market_data.cache_ttl_seconds) must be at least 1")
+	}
+	if c.MarketWSEnabled {
+		if u, err := url.Parse(c.MarketWSURL); err != nil || (u.Scheme != "ws" && u.Scheme != "wss") || u.Host == "" {
+			errs.add("MARKET_WS_URL (market_data.websocket_url) must be a ws:// or wss:// URL")
+		}
+	}
+	if c.MarketWSHeartbeat < time.Second {
+		errs.add("MARKET_WS_HEARTBEAT_SECONDS (market_data.heartbeat_seconds) must be at least 1")
+	}
+	if c.MoveTriggerPct < 0 {
+		errs.add("MOVE_TRIGGER_PCT (market_data.move_trigger_pct) must not be negative")
+	}
+
+	return errs
+}
+
+func (c Config) strategyConfig() StrategyConfig {
+	return StrategyConfig{
+		Type:    c.StrategyType,
+		Period:  c.StrategyPeriod,
+		BandPct: c.StrategyBandPct,
+		Sizing:  Sizing{Mode: c.RebalanceSizing, Fraction: c.RebalanceFraction},
+	}
+}
+
+func (c Config) apply() {
+	ConfigMutex.Lock()
+	defer ConfigMutex.Unlock()
+
+	APIKey = c.APIKey
+	APISecret = c.APISecret
+	APIUrl = c.APIUrl
+	DiscordWebhookURL = c.DiscordWebhookURL
+	APITimeout = c.APITimeout
+	APIMaxRetries = c.APIMaxRetries
+	APIMaxConcurrent = c.APIMaxConcurrent
+
+	IsDryRun = c.DryRun
+	InitialInvestment = c.InitialInvestment
+	TargetAssets = c.Targets
+	Threshold = c.Threshold
+	RebalanceInterval = c.RebalanceInterval
+	MinOrderTHB = c.MinOrderTHB
+	// Validate has already parsed the schedule.
+	if schedule, err := NewSchedule(c.ScheduleCron, c.ScheduleTimezone, c.ScheduleBlackouts); err == nil {
+		RebalanceSchedule = schedule
+	}
+
+	StrategyType = c.StrategyType
+	StrategyPeriod = c.StrategyPeriod
+	StrategyBandPct = c.StrategyBandPct
+	RebalanceSizing = c.RebalanceSizing
+	RebalanceFraction = c.RebalanceFraction
+	DCAMode = c.DCAMode
+	DCAPeriod = c.DCAPeriod
+	DCAAmountTHB = c.DCAAmountTHB
+	DCAPeriods = c.DCAPeriods
+
+	OrderType = c.OrderType
+	LimitOffsetPct = c.LimitOffsetPct
+	LimitTimeout = c.LimitTimeout
+	LimitPollInterval = c.LimitPollInterval
+	LimitMaxReprices = c.LimitMaxReprices
+	LimitMaxSlippagePct = c.LimitMaxSlippagePct
+
+	PaperFeePct = c.PaperFeePct
+	PaperSlippagePct = c.PaperSlippagePct
+
+	MaxOrderTHB = c.MaxOrderTHB
+	MaxTradesPerRun = c.MaxTradesPerRun
+
+	MarketCacheTTL = c.MarketCacheTTL
+	MarketWSEnabled = c.MarketWSEnabled
+	MarketWSURL = c.MarketWSURL
+	MarketWSHeartbeat = c.MarketWSHeartbeat
+	MoveTriggerPct = c.MoveTriggerPct
+}
+
+func setString(dst *string, val string) {
+	if val != "" {
+		*dst = val
+	}
+}
+
+func setValue[T any](dst *T, val *T) {
+	if val != nil {
+		*dst = *val
+	}
+}
+
+func setSeconds(dst *time.Duration, val *int) {
+	if val != nil {
+		*dst = time.Duration(*val) * time.Second
+	}
+}
+
+func envString(name string, dst *string) {
+	if val := os.Getenv(name); val != "" {
+		*dst = val
+	}
+}
+
+func envBool(name string, dst *bool, errs *ConfigErrors) {
+	if raw := strings.TrimSpace(os.Getenv(name)); raw != "" {
+		val, err := strconv.ParseBool(raw)
+		if err != nil {
+			errs.add("%s: %q is not true or false", name, raw)
+			return
+		}
+		*dst = val
+	}
+}
+
+func envFloat(name string, dst *float64, errs *ConfigErrors) {
+	if raw := strings.TrimSpace(os.Getenv(name)); raw != "" {
+		val, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			errs.add("%s: %q is not a number", name, raw)
+			return
+		}
+		*dst = val
+	}
+}
+
+func envInt(name string, dst *int, errs *ConfigErrors) {
+	if raw := strings.TrimSpace(os.Getenv(name)); raw != "" {
+		val, err := strconv.Atoi(raw)
+		if err != nil {
+			errs.add("%s: %q is not a whole number", name, raw)
+			return
+		}
+		*dst = val
+	}
+}
+
+func envSeconds(name string, dst *time.Duration, errs *ConfigErrors) {
+	seconds := int(dst.Seconds())
+	envInt(name, &seconds, errs)
+	*dst = time.Duration(seconds) * time.Second
+}
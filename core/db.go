@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -42,23 +43,212 @@ func InitDB(dbPath string) error {
 		return fmt.Errorf("error creating trades table: %w", err)
 	}
 
+	for column, columnType := range map[string]string{
+		"fill_price": "REAL",
+		"order_id":   "TEXT",
+		"order_hash": "TEXT",
+		"received":   "REAL",
+		"fee":        "REAL",
+		"credit":     "REAL",
+		"rate":       "REAL",
+	} {
+		if err := addColumnIfMissing("trades", column, columnType); err != nil {
+			return err
+		}
+	}
+
+	sqlcmd = `CREATE TABLE IF NOT EXISTS paper_wallet (
+		asset TEXT PRIMARY KEY,
+		balance REAL,
+		updated_at DATETIME)`
+
+	if _, err = DB.Exec(sqlcmd); err != nil {
+		return fmt.Errorf("error creating paper_wallet table: %w", err)
+	}
+
+	sqlcmd = `CREATE TABLE IF NOT EXISTS sessions (
+		id TEXT PRIMARY KEY,
+		username TEXT,
+		csrf_token TEXT,
+		created_at DATETIME,
+		expires_at DATETIME)`
+
+	if _, err = DB.Exec(sqlcmd); err != nil {
+		return fmt.Errorf("error creating sessions table: %w", err)
+	}
+
+	sqlcmd = `CREATE TABLE IF NOT EXISTS api_tokens (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT,
+		token_hash TEXT UNIQUE,
+		scope TEXT,
+		created_at DATETIME,
+		last_used_at DATETIME,
+		revoked INTEGER)`
+
+	if _, err = DB.Exec(sqlcmd); err != nil {
+		return fmt.Errorf("error creating api_tokens table: %w", err)
+	}
+
+	sqlcmd = `CREATE TABLE IF NOT EXISTS users (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		username TEXT UNIQUE,
+		password_hash BLOB,
+		role TEXT,
+		created_at DATETIME,
+		updated_at DATETIME)`
+
+	if _, err = DB.Exec(sqlcmd); err != nil {
+		return fmt.Errorf("error creating users table: %w", err)
+	}
+	if err := addColumnIfMissing("users", "must_change_password", "INTEGER DEFAULT 0"); err != nil {
+		return err
+	}
+
+	sqlcmd = `CREATE TABLE IF NOT EXISTS audit_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		timestamp DATETIME,
+		event TEXT,
+		username TEXT,
+		ip TEXT,
+		user_agent TEXT,
+		detail TEXT)`
+
+	if _, err = DB.Exec(sqlcmd); err != nil {
+		return fmt.Errorf("error creating audit_log table: %w", err)
+	}
+
+	sqlcmd = `CREATE TABLE IF NOT EXISTS settings (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		updated_at DATETIME,
+		updated_by TEXT,
+		payload TEXT)`
+
+	if _, err = DB.Exec(sqlcmd); err != nil {
+		return fmt.Errorf("error creating settings table: %w", err)
+	}
+	for column, columnType := range map[string]string{"source": "TEXT", "changes": "TEXT", "bootstrap": "TEXT"} {
+		if err := addColumnIfMissing("settings", column, columnType); err != nil {
+			return err
+		}
+	}
+
+	sqlcmd = `CREATE TABLE IF NOT EXISTS strategy_state (
+		mode TEXT PRIMARY KEY,
+		last_period TEXT,
+		updated_at DATETIME)`
+
+	if _, err = DB.Exec(sqlcmd); err != nil {
+		return fmt.Errorf("error creating strategy_state table: %w", err)
+	}
+
+	sqlcmd = `CREATE TABLE IF NOT EXISTS dca_state (
+		mode TEXT PRIMARY KEY,
+		last_period TEXT,
+		pending_thb REAL,
+		periods_left INTEGER,
+		updated_at DATETIME)`
+
+	if _, err = DB.Exec(sqlcmd); err != nil {
+		return fmt.Errorf("error creating dca_state table: %w", err)
+	}
+	if err := addColumnIfMissing("dca_state", "retry_thb", "REAL DEFAULT 0"); err != nil {
+		return err
+	}
+
+	sqlcmd = `CREATE TABLE IF NOT EXISTS cash_flows (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		timestamp DATETIME,
+		mode TEXT,
+		type TEXT,
+		amount_thb REAL,
+		source TEXT,
+		reference TEXT,
+		note TEXT,
+		created_by TEXT,
+		created_at DATETIME)`
+
+	if _, err = DB.Exec(sqlcmd); err != nil {
+		return fmt.Errorf("error creating cash_flows table: %w", err)
+	}
+
+	sqlcmd = `CREATE TABLE IF NOT EXISTS snapshots (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		timestamp DATETIME,
+		mode TEXT,
+		total_value REAL)`
+
+	if _, err = DB.Exec(sqlcmd); err != nil {
+		return fmt.Errorf("error creating snapshots table: %w", err)
+	}
+	if _, err = DB.Exec(`CREATE INDEX IF NOT EXISTS snapshots_mode ON snapshots (mode, id)`); err != nil {
+		return fmt.Errorf("error creating snapshots index: %w", err)
+	}
+	for _, column := range []string{"balances", "prices", "weights"} {
+		if err := addColumnIfMissing("snapshots", column, "TEXT"); err != nil {
+			return err
+		}
+	}
+
 	fmt.Println("✅ Database initialized at:", dbPath)
 	return nil
 }
 
-func LogTrade(asset string, operation string, amountTHB float64, coinAmount float64, price float64, mode string, deviation float64, logMessage string) {
+// addColumnIfMissing upgrades tables created by older versions of the bot.
+func addColumnIfMissing(table string, column string, columnType string) error {
+	rows, err := DB.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return fmt.Errorf("error reading %s schema: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, ctype string
+		var dflt sql.NullString
+		if err := rows.Scan(&cid, &name, &ctype, &notNull, &dflt, &pk); err != nil {
+			return fmt.Errorf("error reading %s schema: %w", table, err)
+		}
+		if name == column {
+			return nil
+		}
+	}
+	rows.Close()
+
+	if _, err := DB.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, columnType)); err != nil {
+		return fmt.Errorf("error adding %s.%s: %w", table, column, err)
+	}
+	return nil
+}
+
+func LogTrade(t TradeLog) {
 	if DB == nil {
 		fmt.Println("❌ Error: Database connection is nil. Cannot log trade.")
 		return
 	}
 
-	sqlcmd := `INSERT INTO trades (timestamp, asset, operation, amount_thb, coin_amount, price, mode, deviation, log_message) 
-			   VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
-	_, err := DB.Exec(sqlcmd, time.Now(), asset, operation, amountTHB, coinAmount, price, mode, deviation, logMessage)
+	sqlcmd := `INSERT INTO trades (timestamp, asset, operation, amount_thb, coin_amount, price, mode, deviation, log_message,
+			   fill_price, order_id, order_hash, received, fee, credit, rate) 
+			   VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	now := time.Now()
+	res, err := DB.Exec(sqlcmd, now, t.Asset, t.Operation, t.AmountTHB, t.CoinAmount, t.Price, t.Mode, t.Deviation, t.LogMessage,
+		t.FillPrice, t.OrderID, t.OrderHash, t.Received, t.Fee, t.Credit, t.Rate)
 
 	if err != nil {
 		fmt.Printf("❌ Error saving trade to DB: %v\n", err)
+		return
 	}
+
+	id, _ := res.LastInsertId()
+	PublishEvent(EventTrade, TradeEvent{
+		TradeRecord: TradeRecord{
+			ID: int(id), Timestamp: now.Format("02/01/2006 15:04:05"), Asset: t.Asset, Operation: t.Operation,
+			AmountTHB: t.AmountTHB, CoinAmount: t.CoinAmount, Price: t.Price, Deviation: t.Deviation,
+			FillPrice: t.FillPrice, OrderID: t.OrderID, Fee: t.Fee, Received: t.Received,
+		},
+		Mode: t.Mode,
+	})
+	notifyPortfolioChanged()
 }
 
 func GetProductionTrades(limit int) ([]TradeRecord, error) {
@@ -67,7 +257,8 @@ func GetProductionTrades(limit int) ([]TradeRecord, error) {
 	}
 
 	query := `
-		SELECT id, timestamp, asset, operation, amount_thb, coin_amount, price, deviation
+		SELECT id, timestamp, asset, operation, amount_thb, coin_amount, price, deviation, COALESCE(fill_price, 0),
+			COALESCE(order_id, ''), COALESCE(fee, 0), COALESCE(received, 0)
 		FROM trades
 		WHERE mode = 'PRODUCTION'
 		ORDER BY id DESC
@@ -85,7 +276,8 @@ func GetProductionTrades(limit int) ([]TradeRecord, error) {
 		var r TradeRecord
 		var ts time.Time
 	
-		err := rows.Scan(&r.ID, &ts, &r.Asset, &r.Operation, &r.AmountTHB, &r.CoinAmount, &r.Price, &r.Deviation)
+		err := rows.Scan(&r.ID, &ts, &r.Asset, &r.Operation, &r.AmountTHB, &r.CoinAmount, &r.Price, &r.Deviation, &r.FillPrice,
+			&r.OrderID, &r.Fee, &r.Received)
 		if err != nil {
 			continue
 		}
@@ -96,3 +288,115 @@ func GetProductionTrades(limit int) ([]TradeRecord, error) {
 
 	return trades, nil
 }
+
+// paperWalletMutex is held around every read-modify-write of the paper
+// wallet (paper fills, simulated deposits and withdrawals), so one never
+// saves over the other.
+var paperWalletMutex sync.Mutex
+
+// loadPaperWallet returns the simulated DRY_RUN balances, funding a new
+// wallet with INITIAL_INVESTMENT THB the first time it is used. Callers hold
+// paperWalletMutex.
+func loadPaperWallet() (map[string]float64, error) {
+	if DB == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	rows, err := DB.Query(`SELECT asset, balance FROM paper_wallet`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	balances := map[string]float64{}
+	for rows.Next() {
+		var asset string
+		var balance float64
+		if err := rows.Scan(&asset, &balance); err != nil {
+			return nil, err
+		}
+		balances[asset] = balance
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(balances) == 0 {
+		balances["THB"] = InitialInvestment
+		if err := savePaperWallet(balances); err != nil {
+			return nil, err
+		}
+		fmt.Printf("🧪 Paper wallet funded with %.2f THB\n", InitialInvestment)
+		if InitialInvestment > 0 {
+			_, err := AddCashFlow(CashFlow{Mode: "DRY_RUN", Type: CashDeposit, AmountTHB: InitialInvestment,
+				Source: CashSourceInitial, Note: "INITIAL_INVESTMENT"})
+			if err != nil {
+				fmt.Printf("⚠️ %v\n", err)
+			}
+		}
+	}
+	return balances, nil
+}
+
+func savePaperWallet(balances map[string]float64) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	for asset, balance := range balances {
+		_, err := tx.Exec(`INSERT INTO paper_wallet (asset, balance, updated_at) VALUES (?, ?, ?)
+			ON CONFLICT(asset) DO UPDATE SET balance = excluded.balance, updated_at = excluded.updated_at`,
+			asset, balance, now)
+		if err != nil {
+			return fmt.Errorf("error saving paper wallet: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// creditPaperWallet adds a simulated deposit to the paper wallet, or takes
+// out a withdrawal when amount is negative.
+func creditPaperWallet(asset string, amount float64) error {
+	paperWalletMutex.Lock()
+	defer paperWalletMutex.Unlock()
+
+	balances, err := loadPaperWallet()
+	if err != nil {
+		return err
+	}
+	if balances[asset]+amount < 0 {
+		return fmt.Errorf("paper wallet has only %.2f %s", balances[asset], asset)
+	}
+	balances[asset] += amount
+	if err := savePaperWallet(balances); err != nil {
+		return err
+	}
+	dropMarketData("DRY_RUN")
+	return nil
+}
+
+// ResetPaperWallet empties the simulated wallet; the next read funds it
+// again. The DRY_RUN cash flows, snapshots and DCA reserve belong to the old
+// wallet and go with it.
+func ResetPaperWallet() error {
+	if DB == nil {
+		return fmt.Errorf("database not initialized")
+	}
+	paperWalletMutex.Lock()
+	defer paperWalletMutex.Unlock()
+	for _, table := range []string{"paper_wallet", "cash_flows", "snapshots", "dca_state"} {
+		query := fmt.Sprintf("DELETE FROM %s WHERE mode = 'DRY_RUN'", table)
+		if table == "paper_wallet" {
+			query = "DELETE FROM paper_wallet"
+		}
+		if _, err := DB.Exec(query); err != nil {
+			return err
+		}
+	}
+	resetReturns("DRY_RUN")
+	dropMarketData("DRY_RUN")
+	return nil
+}
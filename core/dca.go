@@ -0,0 +1,359 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// dcaMutex keeps a deposit from being lost while a DCA run updates the state.
+var dcaMutex sync.Mutex
+
+// DCA modes.
+const (
+	DCAOff   = "off"
+	DCAFixed = "fixed"
+	DCASplit = "split"
+)
+
+// DCAState is the deposited cash still waiting to be invested. The
+// rebalancer values the portfolio without it, so a deposit is not bought in
+// one go (or reported as THB being overweight); DCA buys release it over the
+// following periods instead. RetryTHB is the part of the current period's
+// buy that did not go through; later checks in the period try it again.
+type DCAState struct {
+	LastPeriod  string  `json:"last_period"`
+	PendingTHB  float64 `json:"pending_thb"`
+	PeriodsLeft int     `json:"periods_left"`
+	RetryTHB    float64 `json:"retry_thb"`
+}
+
+// DCAStatus is what the dashboard shows about DCA.
+type DCAStatus struct {
+	Mode        string  `json:"mode"`
+	Period      string  `json:"period"`
+	AmountTHB   float64 `json:"amount_thb"`
+	PendingTHB  float64 `json:"pending_thb"`
+	PeriodsLeft int     `json:"periods_left"`
+	LastPeriod  string  `json:"last_period"`
+	RetryTHB    float64 `json:"retry_thb"`
+}
+
+func validateDCA(mode string, period string, amountTHB float64, periods int, minOrderTHB float64) error {
+	switch mode {
+	case DCAOff:
+		return nil
+	case DCAFixed:
+		if amountTHB < minOrderTHB {
+			return fmt.Errorf("fixed DCA amount must be at least MIN_ORDER_THB (%.2f THB)", minOrderTHB)
+		}
+	case DCASplit:
+		if periods < 1 {
+			return fmt.Errorf("split DCA needs at least 1 period")
+		}
+	default:
+		return fmt.Errorf("unknown DCA mode %q (off, fixed or split)", mode)
+	}
+	if period != "daily" && period != "weekly" && period != "monthly" {
+		return fmt.Errorf("DCA period must be daily, weekly or monthly, got %q", period)
+	}
+	return nil
+}
+
+// PlanDCA splits amountTHB of new cash across the coins so the portfolio
+// moves towards its target weights: coins below target get the cash first in
+// proportion to how far below they are, and anything left once they are all
+// at target is split by target weight.
+func PlanDCA(summary PortfolioSummary, amountTHB float64, minOrderTHB float64) []TradePlan {
+	shortfalls := map[string]float64{}
+	totalShortfall, totalTarget := 0.0, 0.0
+	for _, asset := range summary.Portfolio {
+		if asset.Asset == "THB" || asset.TargetPct <= 0 {
+			continue
+		}
+		shortfall := math.Max(0, asset.TargetPct/100.0*summary.TotalValue-asset.BalanceTHB)
+		shortfalls[asset.Asset] = shortfall
+		totalShortfall += shortfall
+		totalTarget += asset.TargetPct
+	}
+
+	plans := []TradePlan{}
+	for _, asset := range summary.Portfolio {
+		shortfall, ok := shortfalls[asset.Asset]
+		if !ok {
+			continue
+		}
+
+		amount := 0.0
+		if totalShortfall >= amountTHB {
+			amount = amountTHB * shortfall / totalShortfall
+		} else {
+			amount = shortfall + (amountTHB-totalShortfall)*asset.TargetPct/totalTarget
+		}
+
+		plan := TradePlan{
+			Asset:     asset.Asset,
+			Operation: "buy",
+			AmountTHB: RoundFloat(amount, 2),
+			Price:     asset.CurrentPrice,
+			ActualPct: asset.ActualPct,
+			TargetPct: asset.TargetPct,
+			Reason:    "DCA",
+		}
+		switch {
+		case asset.CurrentPrice <= 0:
+			plan.Skip = SkipZeroPrice
+		case plan.AmountTHB < minOrderTHB:
+			plan.Skip = SkipBelowMinimum
+		default:
+			plan.CoinAmount = RoundFloat(plan.AmountTHB/asset.CurrentPrice, 8)
+		}
+		plans = append(plans, plan)
+	}
+	return plans
+}
+
+// runDCA makes the DCA buys on the first check of each DCA period and
+// returns the deposited THB that is still reserved for later periods. Buys
+// that fail are retried on the following checks of the same period.
+func runDCA(ctx context.Context, ex Exchange, mode string) float64 {
+	ConfigMutex.RLock()
+	dcaMode, period, fixedTHB, periods := DCAMode, DCAPeriod, DCAAmountTHB, DCAPeriods
+	minOrderTHB, maxOrderTHB := MinOrderTHB, MaxOrderTHB
+	loc := RebalanceSchedule.Location
+	ConfigMutex.RUnlock()
+
+	if dcaMode == DCAOff {
+		return 0
+	}
+
+	dcaMutex.Lock()
+	state := loadDCAState(mode)
+	current := periodKey(period, time.Now().In(loc))
+	newPeriod := state.LastPeriod != current
+	if !newPeriod && state.RetryTHB <= 0 {
+		dcaMutex.Unlock()
+		return state.PendingTHB
+	}
+	if newPeriod {
+		state.LastPeriod = current
+		state.RetryTHB = 0
+		saveDCAState(mode, state)
+	}
+	dcaMutex.Unlock()
+
+	amount := state.RetryTHB
+	if newPeriod {
+		amount = fixedTHB
+		if dcaMode == DCASplit {
+			amount = 0
+			if state.PeriodsLeft > 0 {
+				amount = state.PendingTHB / float64(state.PeriodsLeft)
+			}
+		}
+	}
+
+	spent, failed := 0.0, 0.0
+	if amount > 0 {
+		summary, err := CalculatePortfolio(ex, mode)
+		if err != nil {
+			fmt.Printf("❌ ERROR: DCA ข้ามรอบนี้ อ่านข้อมูลตลาดไม่ครบ: %v\n", err)
+			publishError("DCA skipped, market data incomplete: %v", err)
+			failed = amount
+		} else {
+			spent, failed = buyDCA(ctx, ex, mode, summary, amount, minOrderTHB, maxOrderTHB, dcaMode, current, !newPeriod)
+		}
+	}
+
+	dcaMutex.Lock()
+	defer dcaMutex.Unlock()
+	state = loadDCAState(mode)
+	state.PendingTHB = math.Max(0, state.PendingTHB-spent)
+	state.RetryTHB = RoundFloat(failed, 2)
+	if state.RetryTHB > 0 {
+		fmt.Printf("🔁 DCA: %.2f THB ยังซื้อไม่สำเร็จ จะลองใหม่ในการเช็ครอบถัดไปของช่วง %s\n", state.RetryTHB, current)
+	}
+	if newPeriod && dcaMode == DCASplit && state.PeriodsLeft > 0 {
+		state.PeriodsLeft--
+	}
+	if dcaMode == DCASplit && state.PeriodsLeft == 0 && state.RetryTHB == 0 && state.PendingTHB > 0 {
+		// Whatever was skipped (below the minimum order) goes back to the rebalancer.
+		fmt.Printf("💧 DCA: ครบ %d รอบแล้ว คืนเงินสดที่เหลือ %.2f THB ให้การ rebalance\n", periods, state.PendingTHB)
+		state.PendingTHB = 0
+	}
+	saveDCAState(mode, state)
+	return state.PendingTHB
+}
+
+// buyDCA spreads amount over the coins and returns the THB spent and the THB
+// of buys that failed, were not filled or were skipped for a shutdown.
+func buyDCA(ctx context.Context, ex Exchange, mode string, summary PortfolioSummary, amount float64,
+	minOrderTHB float64, maxOrderTHB float64, dcaMode string, current string, retry bool) (float64, float64) {
+	for _, asset := range summary.Portfolio {
+		if asset.Asset == "THB" && asset.CoinBalance < amount {
+			fmt.Printf("⚠️ DCA: THB ไม่พอ (%.2f จาก %.2f THB) → ซื้อเท่าที่มี\n", asset.CoinBalance, amount)
+			amount = asset.CoinBalance
+		}
+	}
+
+	label := ""
+	if retry {
+		label = " ลองใหม่"
+	}
+	fmt.Printf("\n--- DCA%s (%s %s) | ลงทุน %.2f THB ---\n", label, dcaMode, current, amount)
+
+	spent, failed := 0.0, 0.0
+	for _, plan := range PlanDCA(summary, amount, minOrderTHB) {
+		switch plan.Skip {
+		case SkipZeroPrice:
+			fmt.Printf("❌ ERROR: ราคา %s เป็นศูนย์. ไม่สามารถคำนวณปริมาณได้.\n", plan.Asset)
+			failed += plan.AmountTHB
+			continue
+		case SkipBelowMinimum:
+			fmt.Printf("⏸️ DCA SKIP: %s มูลค่า %.2f THB น้อยกว่าขั้นต่ำ %.2f THB\n", plan.Asset, plan.AmountTHB, minOrderTHB)
+			continue
+		}
+		if ctx.Err() != nil {
+			fmt.Printf("🛑 Shutting down, skipping DCA buy %s\n", plan.Asset)
+			failed += plan.AmountTHB
+			continue
+		}
+		if maxOrderTHB > 0 && plan.AmountTHB > maxOrderTHB {
+			fmt.Printf("🛑 RISK: ลดขนาดคำสั่งจาก %.2f เหลือ %.2f THB (MAX_ORDER_THB)\n", plan.AmountTHB, maxOrderTHB)
+			plan.AmountTHB = maxOrderTHB
+			plan.CoinAmount = RoundFloat(maxOrderTHB/plan.Price, 8)
+		}
+
+		fmt.Printf("💧 DCA %s: ซื้อ %.8f %s มูลค่า %.2f THB (สัดส่วน %.2f%% / เป้าหมาย %.2f%%)\n",
+			mode, plan.CoinAmount, plan.Asset, plan.AmountTHB, plan.ActualPct, plan.TargetPct)
+
+		result, err := ExecutePlan(ctx, ex, plan)
+		amountTHB, coinAmount := plan.AmountTHB, plan.CoinAmount
+		if result.FilledAmount > 0 {
+			amountTHB, coinAmount = result.Amounts(plan.Operation)
+		}
+
+		logMessage := ""
+		if err != nil {
+			logMessage = fmt.Sprintf("DCA ล้มเหลว: %v", err)
+			fmt.Printf("❌ ERROR: %s\n", logMessage)
+			if result.FilledAmount > 0 {
+				// Part of it filled before the error; only the rest is retried.
+				spent += amountTHB
+				failed += math.Max(0, plan.AmountTHB-amountTHB)
+			} else {
+				failed += plan.AmountTHB
+			}
+		} else if result.Status == "unfilled" {
+			logMessage = fmt.Sprintf("DCA ไม่ถูกจับคู่: Order %s cancelled without a fill", result.OrderID)
+			fmt.Printf("⏸️ %s\n", logMessage)
+			failed += plan.AmountTHB
+		} else {
+			logMessage = fmt.Sprintf("DCA สำเร็จ: Order %s (%s)", result.OrderID, result.Status)
+			spent += amountTHB
+			if result.Status == "partial_filled" {
+				failed += math.Max(0, plan.AmountTHB-amountTHB)
+			}
+			SendDiscordTrade(plan.Asset, TradeDCABuy, amountTHB, coinAmount, result.FillPrice, mode)
+		}
+
+		LogTrade(TradeLog{
+			Asset: plan.Asset, Operation: TradeDCABuy, AmountTHB: amountTHB, CoinAmount: coinAmount,
+			Price: plan.Price, FillPrice: result.FillPrice, Mode: mode, LogMessage: logMessage,
+			OrderID: result.OrderID, OrderHash: result.OrderHash, Received: result.Received,
+			Fee: result.Fee, Credit: result.Credit, Rate: result.Rate,
+		})
+	}
+	return spent, failed
+}
+
+// RecordDCADeposit reserves a THB deposit for DCA in the current mode and
+// enters it in the cash-flow ledger. In DRY_RUN the paper wallet is credited
+// as well; in PRODUCTION the money must already have been deposited on Bitkub.
+func RecordDCADeposit(amountTHB float64, actor string) error {
+	if amountTHB <= 0 {
+		return fmt.Errorf("deposit must be greater than 0 THB")
+	}
+
+	ConfigMutex.RLock()
+	dryRun, dcaMode, periods := IsDryRun, DCAMode, DCAPeriods
+	ConfigMutex.RUnlock()
+	if dcaMode == DCAOff {
+		return fmt.Errorf("DCA is off (set DCA_MODE to fixed or split)")
+	}
+
+	mode := "PRODUCTION"
+	if dryRun {
+		mode = "DRY_RUN"
+		if err := creditPaperWallet("THB", amountTHB); err != nil {
+			return err
+		}
+	}
+	_, err := AddCashFlow(CashFlow{Mode: mode, Type: CashDeposit, AmountTHB: amountTHB, Source: CashSourceDCA, CreatedBy: actor})
+	if err != nil {
+		return err
+	}
+
+	dcaMutex.Lock()
+	defer dcaMutex.Unlock()
+	state := loadDCAState(mode)
+	state.PendingTHB += amountTHB
+	if dcaMode == DCASplit {
+		// The new total is spread over a fresh set of periods.
+		state.PeriodsLeft = periods
+	}
+	saveDCAState(mode, state)
+
+	fmt.Printf("💧 DCA %s: รับเงินฝาก %.2f THB (รอลงทุน %.2f THB)\n", mode, amountTHB, state.PendingTHB)
+	return nil
+}
+
+// CurrentDCAStatus reports DCA progress for the current mode.
+func CurrentDCAStatus() DCAStatus {
+	ConfigMutex.RLock()
+	status := DCAStatus{Mode: DCAMode, Period: DCAPeriod, AmountTHB: DCAAmountTHB}
+	mode := "PRODUCTION"
+	if IsDryRun {
+		mode = "DRY_RUN"
+	}
+	ConfigMutex.RUnlock()
+
+	if status.Mode != DCAOff {
+		state := loadDCAState(mode)
+		status.PendingTHB = state.PendingTHB
+		status.PeriodsLeft = state.PeriodsLeft
+		status.LastPeriod = state.LastPeriod
+		status.RetryTHB = state.RetryTHB
+	}
+	return status
+}
+
+// DCA state is kept per mode, like the strategy state.
+func loadDCAState(mode string) DCAState {
+	state := DCAState{}
+	if DB == nil {
+		return state
+	}
+	err := DB.QueryRow(`SELECT last_period, pending_thb, periods_left, COALESCE(retry_thb, 0) FROM dca_state WHERE mode = ?`, mode).
+		Scan(&state.LastPeriod, &state.PendingTHB, &state.PeriodsLeft, &state.RetryTHB)
+	if err != nil && err != sql.ErrNoRows {
+		fmt.Printf("⚠️ Failed to load DCA state: %v\n", err)
+	}
+	return state
+}
+
+func saveDCAState(mode string, state DCAState) {
+	if DB == nil {
+		return
+	}
+	_, err := DB.Exec(`INSERT INTO dca_state (mode, last_period, pending_thb, periods_left, retry_thb, updated_at) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(mode) DO UPDATE SET last_period = excluded.last_period, pending_thb = excluded.pending_thb,
+			periods_left = excluded.periods_left, retry_thb = excluded.retry_thb, updated_at = excluded.updated_at`,
+		mode, state.LastPeriod, state.PendingTHB, state.PeriodsLeft, state.RetryTHB, time.Now())
+	if err != nil {
+		fmt.Printf("⚠️ Failed to save DCA state: %v\n", err)
+	}
+}
@@ -0,0 +1,184 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Snapshot is the portfolio as seen by one rebalance check. Weights are in
+// percent of TotalValue. NetInvested is filled in by EquityHistory.
+type Snapshot struct {
+	Timestamp   time.Time          `json:"timestamp"`
+	Mode        string             `json:"mode"`
+	TotalValue  float64            `json:"total_value"`
+	NetInvested float64            `json:"net_invested"`
+	Balances    map[string]float64 `json:"balances"`
+	Prices      map[string]float64 `json:"prices"`
+	Weights     map[string]float64 `json:"weights"`
+}
+
+// RecordSnapshot stores the portfolio seen by a rebalance check.
+// reservedTHB is cash the summary left out (DCA deposits) but which is still
+// part of the portfolio. Checks that could not price or read the wallet are
+// not recorded, as a missing balance would look like a loss.
+func RecordSnapshot(mode string, summary PortfolioSummary, reservedTHB float64) {
+	if DB == nil {
+		return
+	}
+
+	value := reservedTHB
+	balances := make(map[string]float64, len(summary.Portfolio))
+	prices := make(map[string]float64, len(summary.Portfolio))
+	for _, asset := range summary.Portfolio {
+		if asset.CoinBalance > 0 && asset.CurrentPrice <= 0 {
+			return
+		}
+		value += asset.BalanceTHB
+		balances[asset.Asset] = asset.CoinBalance
+		prices[asset.Asset] = asset.CurrentPrice
+	}
+	if value <= 0 {
+		return
+	}
+	if reservedTHB > 0 {
+		balances["THB"] += reservedTHB
+		prices["THB"] = 1.0
+	}
+
+	weights := make(map[string]float64, len(balances))
+	for asset, balance := range balances {
+		weights[asset] = RoundFloat(balance*prices[asset]/value*100.0, 4)
+	}
+
+	balancesJSON, _ := json.Marshal(balances)
+	pricesJSON, _ := json.Marshal(prices)
+	weightsJSON, _ := json.Marshal(weights)
+	if _, err := DB.Exec(`INSERT INTO snapshots (timestamp, mode, total_value, balances, prices, weights) VALUES (?, ?, ?, ?, ?, ?)`,
+		time.Now(), mode, value, string(balancesJSON), string(pricesJSON), string(weightsJSON)); err != nil {
+		fmt.Printf("⚠️ Failed to save snapshot: %v\n", err)
+	}
+}
+
+// EquityQuery selects part of a mode's snapshot history. A zero From or To
+// leaves that end open. Interval keeps the last snapshot of each interval;
+// without one, Points caps the number returned by spreading them evenly over
+// the range. With neither, every snapshot is returned.
+type EquityQuery struct {
+	Mode     string
+	From     time.Time
+	To       time.Time
+	Interval time.Duration
+	Points   int
+}
+
+// EquityHistory returns the equity curve for q, oldest first.
+func EquityHistory(q EquityQuery) ([]Snapshot, error) {
+	if DB == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+	if !q.From.IsZero() && !q.To.IsZero() && q.To.Before(q.From) {
+		return nil, fmt.Errorf("to is before from")
+	}
+
+	query := `SELECT timestamp, total_value, COALESCE(balances, '{}'), COALESCE(prices, '{}'), COALESCE(weights, '{}')
+		FROM snapshots WHERE mode = ?`
+	args := []interface{}{q.Mode}
+	if !q.From.IsZero() {
+		query += ` AND timestamp >= ?`
+		args = append(args, q.From)
+	}
+	if !q.To.IsZero() {
+		query += ` AND timestamp <= ?`
+		args = append(args, q.To)
+	}
+	rows, err := DB.Query(query+` ORDER BY id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snapshots := []Snapshot{}
+	for rows.Next() {
+		s := Snapshot{Mode: q.Mode}
+		var balances, prices, weights string
+		if err := rows.Scan(&s.Timestamp, &s.TotalValue, &balances, &prices, &weights); err != nil {
+			return nil, err
+		}
+		// Snapshots taken before these columns existed only have a total.
+		json.Unmarshal([]byte(balances), &s.Balances)
+		json.Unmarshal([]byte(prices), &s.Prices)
+		json.Unmarshal([]byte(weights), &s.Weights)
+		snapshots = append(snapshots, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	snapshots = downsample(snapshots, q.Interval, q.Points)
+
+	flows, err := ListCashFlows(q.Mode, 0)
+	if err != nil {
+		return nil, err
+	}
+	addNetInvested(snapshots, flows)
+	return snapshots, nil
+}
+
+// downsample keeps the last snapshot of each bucket, so every point is a
+// value the portfolio actually had.
+func downsample(snapshots []Snapshot, interval time.Duration, points int) []Snapshot {
+	if len(snapshots) < 2 {
+		return snapshots
+	}
+	if interval <= 0 {
+		if points <= 0 || len(snapshots) <= points {
+			return snapshots
+		}
+		span := snapshots[len(snapshots)-1].Timestamp.Sub(snapshots[0].Timestamp)
+		interval = span / time.Duration(points)
+		if interval <= 0 {
+			return snapshots[len(snapshots)-points:]
+		}
+	}
+
+	start := snapshots[0].Timestamp
+	bucket := func(s Snapshot) int64 { return int64(s.Timestamp.Sub(start) / interval) }
+
+	kept := []Snapshot{}
+	for i, s := range snapshots {
+		if i == len(snapshots)-1 || bucket(snapshots[i+1]) != bucket(s) {
+			kept = append(kept, s)
+		}
+	}
+	// Even buckets can still overshoot by one when the last snapshot starts its own.
+	if points > 0 && len(kept) > points {
+		kept = kept[len(kept)-points:]
+	}
+	return kept
+}
+
+// addNetInvested sets each snapshot's deposits minus withdrawals up to that
+// time, so the curve can be drawn against the cash put in.
+func addNetInvested(snapshots []Snapshot, flows []CashFlow) {
+	if len(flows) == 0 {
+		ConfigMutex.RLock()
+		initial := InitialInvestment
+		ConfigMutex.RUnlock()
+		for i := range snapshots {
+			snapshots[i].NetInvested = initial
+		}
+		return
+	}
+
+	sort.Slice(flows, func(i, j int) bool { return flows[i].Timestamp.Before(flows[j].Timestamp) })
+	next, net := 0, 0.0
+	for i := range snapshots {
+		for next < len(flows) && !flows[next].Timestamp.After(snapshots[i].Timestamp) {
+			net += flows[next].Signed()
+			next++
+		}
+		snapshots[i].NetInvested = RoundFloat(net, 2)
+	}
+}
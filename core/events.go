@@ -0,0 +1,127 @@
+package core
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Event types pushed to dashboards over /api/stream. Errors are not called
+// "error", which EventSource uses for its own connection errors.
+const (
+	EventPortfolio = "portfolio"
+	EventTrade     = "trade"
+	EventMode      = "mode"
+	EventError     = "bot_error"
+)
+
+// Event is one message for the dashboards. Data is sent as JSON.
+type Event struct {
+	Type string
+	Data interface{}
+}
+
+// ErrorEvent reports a problem the bot hit while running.
+type ErrorEvent struct {
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+}
+
+// TradeEvent is a trade as soon as it is logged, in the shape /api/history
+// returns it.
+type TradeEvent struct {
+	TradeRecord
+	Mode string `json:"mode"`
+}
+
+// ModeEvent reports a switch between DRY_RUN and PRODUCTION.
+type ModeEvent struct {
+	Mode  string `json:"mode"`
+	Actor string `json:"actor"`
+}
+
+var (
+	eventSubscribers = map[chan Event]struct{}{}
+	eventMutex       sync.Mutex
+	eventsClosed     bool
+
+	// portfolioChanged wakes the portfolio publisher. It holds one signal,
+	// so a burst of changes is coalesced into one update.
+	portfolioChanged = make(chan struct{}, 1)
+)
+
+// SubscribeEvents registers a dashboard stream. The channel is closed when
+// the server shuts down; call the returned func when the client goes away.
+// A client too slow to keep up misses events rather than holding up the
+// others.
+func SubscribeEvents() (<-chan Event, func()) {
+	ch := make(chan Event, 32)
+
+	eventMutex.Lock()
+	defer eventMutex.Unlock()
+	if eventsClosed {
+		close(ch)
+		return ch, func() {}
+	}
+	eventSubscribers[ch] = struct{}{}
+
+	return ch, func() {
+		eventMutex.Lock()
+		defer eventMutex.Unlock()
+		if _, ok := eventSubscribers[ch]; ok {
+			delete(eventSubscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// EventSubscribers is the number of open dashboard streams.
+func EventSubscribers() int {
+	eventMutex.Lock()
+	defer eventMutex.Unlock()
+	return len(eventSubscribers)
+}
+
+// PublishEvent sends an event to every open stream.
+func PublishEvent(eventType string, data interface{}) {
+	eventMutex.Lock()
+	defer eventMutex.Unlock()
+	for ch := range eventSubscribers {
+		select {
+		case ch <- Event{Type: eventType, Data: data}:
+		default:
+		}
+	}
+}
+
+// CloseEventStreams ends every stream so the HTTP server can shut down;
+// streams never go idle on their own.
+func CloseEventStreams() {
+	eventMutex.Lock()
+	defer eventMutex.Unlock()
+	eventsClosed = true
+	for ch := range eventSubscribers {
+		delete(eventSubscribers, ch)
+		close(ch)
+	}
+}
+
+// publishError reports a problem to the dashboards. Callers still log it.
+func publishError(format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	PublishEvent(EventError, ErrorEvent{Time: time.Now(), Message: message})
+}
+
+// notifyPortfolioChanged tells the publisher the portfolio may look
+// different now (new prices, balances, cash flows or mode).
+func notifyPortfolioChanged() {
+	select {
+	case portfolioChanged <- struct{}{}:
+	default:
+	}
+}
+
+// PortfolioChanged signals when the portfolio may have changed.
+func PortfolioChanged() <-chan struct{} {
+	return portfolioChanged
+}
@@ -0,0 +1,107 @@
+package core
+
+import "time"
+
+// Exchange is everything the rebalancer needs from a trading venue. Assets are
+// plain symbols ("BTC", "THB"); each implementation maps them to its own
+// market names.
+type Exchange interface {
+	Name() string
+	Ticker(asset string) (float64, error)
+	Quote(asset string) (Quote, error)
+	Balances() (map[string]float64, error)
+	PlaceOrder(req OrderRequest) (Order, error)
+	OrderInfo(asset string, side string, orderID string) (OrderInfo, error)
+	CancelOrder(asset string, side string, orderID string) error
+}
+
+// Venue holds the real exchange and the paper one used in DRY_RUN.
+type Venue struct {
+	Live  Exchange
+	Paper Exchange
+}
+
+// Current returns the exchange for the mode the bot is in right now,
+// together with that mode, read once so callers act on a consistent pair.
+func (v Venue) Current() (Exchange, bool) {
+	ConfigMutex.RLock()
+	dryRun := IsDryRun
+	ConfigMutex.RUnlock()
+
+	if dryRun {
+		return v.Paper, true
+	}
+	return v.Live, false
+}
+
+// modeName is how a mode is stored and shown: DRY_RUN or PRODUCTION.
+func modeName(dryRun bool) string {
+	if dryRun {
+		return "DRY_RUN"
+	}
+	return "PRODUCTION"
+}
+
+// OrderRequest describes an order against THB. Amount is in THB for buys and
+// in coin units for sells, matching Bitkub's place-bid/place-ask.
+type OrderRequest struct {
+	Asset  string
+	Side   string
+	Amount float64
+	Type   string
+	Rate   float64
+}
+
+// Order is the exchange's acknowledgement of a placed order. Received is
+// what the order yields: coins for buys, THB for sells. Credit is the fee
+// credit Bitkub applied.
+type Order struct {
+	ID        string
+	Hash      string
+	Asset     string
+	Side      string
+	Type      string
+	Amount    float64
+	Rate      float64
+	Fee       float64
+	Credit    float64
+	Received  float64
+	Timestamp time.Time
+}
+
+// FillPrice is the effective price of the order before fees. Limit orders
+// carry their rate; for market orders it is derived from the amounts.
+func (o Order) FillPrice() float64 {
+	if o.Rate > 0 {
+		return o.Rate
+	}
+	if o.Received <= 0 || o.Amount <= 0 {
+		return 0
+	}
+	if o.Side == "buy" {
+		return (o.Amount - o.Fee + o.Credit) / o.Received
+	}
+	return (o.Received + o.Fee - o.Credit) / o.Amount
+}
+
+// Quote is the top of the book for an asset against THB.
+type Quote struct {
+	Last float64
+	Bid  float64
+	Ask  float64
+}
+
+// OrderInfo is the exchange's view of a placed order. Status is one of
+// "unfilled", "partial_filled", "filled" or "cancelled".
+type OrderInfo struct {
+	ID        string
+	Side      string
+	Status    string
+	Amount    float64
+	Filled    float64
+	Remaining float64
+	Rate      float64
+	Fee       float64
+	Credit    float64
+	AvgPrice  float64
+}
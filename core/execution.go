@@ -0,0 +1,221 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+// ExecutionResult is what actually happened on the exchange for a plan.
+// FilledAmount uses the order's units (THB for buys, coin for sells).
+type ExecutionResult struct {
+	OrderID      string
+	OrderHash    string
+	FillPrice    float64
+	FilledAmount float64
+	Status       string
+	Rate         float64
+	Fee          float64
+	Credit       float64
+	Received     float64
+}
+
+// Amounts converts the filled amount into THB and coin units.
+func (r ExecutionResult) Amounts(side string) (float64, float64) {
+	if r.FillPrice <= 0 {
+		return 0, 0
+	}
+	if side == "buy" {
+		return r.FilledAmount, r.FilledAmount / r.FillPrice
+	}
+	return r.FilledAmount * r.FillPrice, r.FilledAmount
+}
+
+// ExecutePlan sends a rebalance plan to the exchange with the configured
+// order type. Cancelling ctx never abandons an order that was placed: a
+// resting limit order is cancelled and whatever filled is returned.
+func ExecutePlan(ctx context.Context, ex Exchange, plan TradePlan) (ExecutionResult, error) {
+	ConfigMutex.RLock()
+	orderType := OrderType
+	ConfigMutex.RUnlock()
+
+	if orderType == "limit" {
+		return executeLimit(ctx, ex, plan)
+	}
+
+	order, err := ex.PlaceOrder(OrderRequest{Asset: plan.Asset, Side: plan.Operation, Amount: plan.OrderAmount(), Type: "market"})
+	if err != nil {
+		return ExecutionResult{}, err
+	}
+
+	result := ExecutionResult{
+		OrderID:      order.ID,
+		OrderHash:    order.Hash,
+		FillPrice:    order.FillPrice(),
+		FilledAmount: order.Amount,
+		Status:       "filled",
+		Rate:         order.Rate,
+		Fee:          order.Fee,
+		Credit:       order.Credit,
+		Received:     order.Received,
+	}
+	if result.FillPrice <= 0 {
+		result.FillPrice = plan.Price
+	}
+	return result, nil
+}
+
+// limitPrice applies the offset to the side of the book we would trade against.
+func limitPrice(quote Quote, side string, offsetPct float64) float64 {
+	if side == "buy" {
+		return RoundFloat(quote.Ask*(1+offsetPct/100.0), 2)
+	}
+	return RoundFloat(quote.Bid*(1-offsetPct/100.0), 2)
+}
+
+// executeLimit places a limit order, polls it until it fills and reprices
+// the remainder after each timeout. It gives up (leaving the remainder
+// unfilled) once LimitMaxReprices is used up or the new price would be more
+// than LimitMaxSlippagePct away from the price the plan was made at, or when
+// ctx is cancelled.
+func executeLimit(ctx context.Context, ex Exchange, plan TradePlan) (ExecutionResult, error) {
+	ConfigMutex.RLock()
+	offsetPct := LimitOffsetPct
+	timeout := LimitTimeout
+	pollInterval := LimitPollInterval
+	maxReprices := LimitMaxReprices
+	maxSlippagePct := LimitMaxSlippagePct
+	minOrderTHB := MinOrderTHB
+	ConfigMutex.RUnlock()
+
+	result := ExecutionResult{Status: "unfilled"}
+	remaining := plan.OrderAmount()
+	notional := 0.0
+
+	for attempt := 0; attempt <= maxReprices && remaining > 0; attempt++ {
+		// Bitkub rejects bids below the minimum order value.
+		if plan.Operation == "buy" && remaining < minOrderTHB {
+			break
+		}
+
+		quote, err := ex.Quote(plan.Asset)
+		if err != nil {
+			return finishLimit(result, notional), fmt.Errorf("failed to fetch order book for %s: %w", plan.Asset, err)
+		}
+
+		price := limitPrice(quote, plan.Operation, offsetPct)
+		if plan.Price > 0 && math.Abs(price-plan.Price)/plan.Price*100.0 > maxSlippagePct {
+			return finishLimit(result, notional), fmt.Errorf("limit price %.2f is more than %.2f%% away from %.2f, not placing %s order",
+				price, maxSlippagePct, plan.Price, plan.Operation)
+		}
+
+		order, err := ex.PlaceOrder(OrderRequest{Asset: plan.Asset, Side: plan.Operation, Amount: remaining, Type: "limit", Rate: price})
+		if err != nil {
+			return finishLimit(result, notional), err
+		}
+		result.OrderID = order.ID
+		result.OrderHash = order.Hash
+		result.Rate = price
+		fmt.Printf("📌 LIMIT %s %s @ %.2f (ครั้งที่ %d) order id %s\n", plan.Operation, plan.Asset, price, attempt+1, order.ID)
+
+		// On an error info is the last state read, which may hold a fill
+		// that still has to be accounted for.
+		info, err := waitForFill(ctx, ex, plan, order.ID, timeout, pollInterval)
+		if info.Filled > 0 {
+			result.FilledAmount += info.Filled
+			notional += info.Filled * info.AvgPrice
+			result.Fee += info.Fee
+			result.Credit += info.Credit
+			if plan.Operation == "buy" {
+				result.Received += info.Filled / info.AvgPrice
+			} else {
+				result.Received += info.Filled*info.AvgPrice - info.Fee + info.Credit
+			}
+		}
+		if err != nil {
+			if result.FilledAmount > 0 {
+				result.Status = "partial_filled"
+			}
+			return finishLimit(result, notional), err
+		}
+		if info.Status == "filled" {
+			remaining = 0
+			break
+		}
+		remaining = info.Remaining
+		if ctx.Err() != nil {
+			fmt.Printf("🛑 LIMIT %s %s: shutting down, not repricing the remaining %.8f\n", plan.Operation, plan.Asset, remaining)
+			break
+		}
+		fmt.Printf("🔁 LIMIT %s %s ยังไม่ครบหลัง %s (คงเหลือ %.8f) → ยกเลิกและตั้งราคาใหม่\n",
+			plan.Operation, plan.Asset, timeout, remaining)
+	}
+
+	if remaining <= 0 {
+		result.Status = "filled"
+	} else if result.FilledAmount > 0 {
+		result.Status = "partial_filled"
+	}
+	return finishLimit(result, notional), nil
+}
+
+// waitForFill polls the order until it is filled or the timeout expires (or
+// ctx is cancelled), in which case the order is cancelled and its final
+// state returned. If the final state cannot be read, the last state polled
+// is returned with the error so a fill seen so far is not lost.
+func waitForFill(ctx context.Context, ex Exchange, plan TradePlan, orderID string, timeout time.Duration, pollInterval time.Duration) (OrderInfo, error) {
+	deadline := time.Now().Add(timeout)
+	last := OrderInfo{ID: orderID, Side: plan.Operation}
+	for {
+		select {
+		case <-ctx.Done():
+			fmt.Printf("🛑 Shutting down, cancelling open order %s\n", orderID)
+			deadline = time.Time{}
+		case <-time.After(pollInterval):
+		}
+
+		info, err := ex.OrderInfo(plan.Asset, plan.Operation, orderID)
+		if err != nil {
+			fmt.Printf("⚠️ order-info %s failed: %v\n", orderID, err)
+		} else if info.Status == "filled" || info.Status == "cancelled" {
+			return info, nil
+		} else {
+			last = info
+		}
+
+		if time.Now().After(deadline) {
+			break
+		}
+	}
+
+	if err := ex.CancelOrder(plan.Asset, plan.Operation, orderID); err != nil {
+		// The order may have filled between the last poll and the cancel.
+		fmt.Printf("⚠️ cancel-order %s failed: %v\n", orderID, err)
+	}
+
+	var err error
+	for try := 1; try <= finalStateTries; try++ {
+		var info OrderInfo
+		if info, err = ex.OrderInfo(plan.Asset, plan.Operation, orderID); err == nil {
+			return info, nil
+		}
+		fmt.Printf("⚠️ order-info %s after cancel failed (%d/%d): %v\n", orderID, try, finalStateTries, err)
+		if try < finalStateTries {
+			time.Sleep(pollInterval)
+		}
+	}
+	fmt.Printf("⚠️ order %s: using the last known state (filled %.8f); check the order on Bitkub\n", orderID, last.Filled)
+	return last, fmt.Errorf("order %s: failed to read final state after cancel: %w", orderID, err)
+}
+
+// finalStateTries is how often the state of a cancelled order is read
+// before falling back to the last state polled.
+const finalStateTries = 3
+
+func finishLimit(result ExecutionResult, notional float64) ExecutionResult {
+	if result.FilledAmount > 0 {
+		result.FillPrice = notional / result.FilledAmount
+	}
+	return result
+}
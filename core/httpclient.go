@@ -0,0 +1,309 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Retry timing for Bitkub calls. A Retry-After longer than maxRetryAfter is
+// not waited out; the call fails instead.
+const (
+	retryBaseDelay = 500 * time.Millisecond
+	retryMaxDelay  = 10 * time.Second
+	maxRetryAfter  = time.Minute
+
+	// maxAPIRetries bounds BITKUB_MAX_RETRIES; with the 10s cap on the
+	// backoff, more retries would keep one call going for many minutes.
+	maxAPIRetries = 10
+)
+
+// bitkubErrorMessages describes the Bitkub error codes the bot is most
+// likely to meet.
+var bitkubErrorMessages = map[int]string{
+	1:  "invalid JSON payload",
+	2:  "missing X-BTK-APIKEY",
+	3:  "invalid API key",
+	4:  "API pending for activation",
+	5:  "IP not allowed",
+	6:  "missing or invalid signature",
+	7:  "missing timestamp",
+	8:  "invalid timestamp",
+	9:  "invalid user",
+	10: "invalid parameter",
+	11: "invalid symbol",
+	12: "invalid amount",
+	13: "invalid rate",
+	14: "improper rate",
+	15: "amount too low",
+	16: "failed to get balance",
+	17: "wallet is empty",
+	18: "insufficient balance",
+	21: "invalid order for cancellation",
+	22: "invalid side",
+	24: "invalid order for lookup",
+	25: "KYC level 1 is required",
+	30: "limit exceeds",
+	52: "invalid permission",
+	55: "cancel only mode",
+	56: "user suspended from purchasing",
+	57: "user suspended from selling",
+	90: "server error",
+}
+
+// APIError is a request Bitkub answered with an error: an HTTP error status
+// or a non-zero "error" code in the body. Code is 0 when Bitkub sent no code.
+type APIError struct {
+	Endpoint   string
+	Status     int
+	Code       int
+	Message    string
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	if e.Code != 0 {
+		return fmt.Sprintf("bitkub %s: error %d (%s)", e.Endpoint, e.Code, e.Message)
+	}
+	return fmt.Sprintf("bitkub %s: HTTP %d: %s", e.Endpoint, e.Status, e.Message)
+}
+
+// RateLimited reports whether Bitkub rejected the request for going over
+// its rate limit; such a request was not processed.
+func (e *APIError) RateLimited() bool {
+	return e.Status == http.StatusTooManyRequests
+}
+
+// Temporary reports whether sending the same request again may succeed.
+func (e *APIError) Temporary() bool {
+	return e.RateLimited() || e.Status >= 500 || e.Code == 90
+}
+
+// apiRequest is one call to Bitkub. Build is run for every attempt so a
+// retry is signed with a fresh timestamp. Idempotent calls are retried on
+// network errors and server errors; others only when Bitkub did not get or
+// did not process them (a failed dial or a 429).
+type apiRequest struct {
+	Endpoint   string
+	Idempotent bool
+	Build      func() (*http.Request, error)
+}
+
+// APIClient is the HTTP client every Bitkub REST call goes through. It
+// reuses connections, caps how many requests are in flight and pauses all
+// calls while Bitkub is rate limiting the bot. Timeout, retries and the
+// concurrency cap are read from BITKUB_TIMEOUT_SECONDS, BITKUB_MAX_RETRIES
+// and BITKUB_MAX_CONCURRENT on every call, so a config reload applies them.
+type APIClient struct {
+	http *http.Client
+
+	mu          sync.Mutex
+	slotFree    *sync.Cond
+	inFlight    int
+	pausedUntil time.Time
+}
+
+func NewAPIClient() *APIClient {
+	c := &APIClient{http: &http.Client{}}
+	c.slotFree = sync.NewCond(&c.mu)
+	return c
+}
+
+// bitkubClient is shared by every BitkubExchange.
+var bitkubClient = NewAPIClient()
+
+// Do sends the request, retrying with exponential backoff and jitter, and
+// returns the response body. Cancelling ctx ends the waits between
+// attempts; a request already sent is left to finish.
+func (c *APIClient) Do(ctx context.Context, req apiRequest) ([]byte, error) {
+	ConfigMutex.RLock()
+	timeout, retries, limit := APITimeout, APIMaxRetries, APIMaxConcurrent
+	ConfigMutex.RUnlock()
+
+	for attempt := 0; ; attempt++ {
+		httpReq, err := req.Build()
+		if err != nil {
+			return nil, fmt.Errorf("bitkub %s: failed to build request: %w", req.Endpoint, err)
+		}
+
+		body, err := c.send(ctx, req.Endpoint, httpReq, timeout, limit)
+		if err == nil {
+			return body, nil
+		}
+		if attempt >= retries || ctx.Err() != nil || !retryable(err, req.Idempotent) {
+			return nil, err
+		}
+
+		wait := backoffDelay(attempt)
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.RetryAfter > wait {
+			wait = apiErr.RetryAfter
+		}
+		fmt.Printf("🔁 %v, retry %d/%d in %s\n", err, attempt+1, retries, wait.Round(100*time.Millisecond))
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("bitkub %s: %w (gave up retrying: %v)", req.Endpoint, ctx.Err(), err)
+		case <-timer.C:
+		}
+	}
+}
+
+// send makes one attempt once a slot is free and no rate limit pause is
+// running.
+func (c *APIClient) send(ctx context.Context, endpoint string, req *http.Request, timeout time.Duration, limit int) ([]byte, error) {
+	if err := c.acquire(ctx, limit); err != nil {
+		return nil, fmt.Errorf("bitkub %s: %w", endpoint, err)
+	}
+	defer c.release()
+
+	reqCtx, cancel := context.WithTimeout(req.Context(), timeout)
+	defer cancel()
+
+	resp, err := c.http.Do(req.WithContext(reqCtx))
+	if err != nil {
+		return nil, fmt.Errorf("bitkub %s: %w", endpoint, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("bitkub %s: failed to read response: %w", endpoint, err)
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		apiErr := &APIError{Endpoint: endpoint, Status: resp.StatusCode, Message: "rate limited"}
+		apiErr.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+		c.pause(apiErr.RetryAfter)
+		return nil, apiErr
+	}
+
+	var errorCheck struct {
+		Error   *int   `json:"error"`
+		Message string `json:"message"`
+	}
+	decoded := json.Unmarshal(body, &errorCheck) == nil
+	code := 0
+	if decoded && errorCheck.Error != nil {
+		code = *errorCheck.Error
+	}
+
+	if resp.StatusCode >= 400 || code != 0 {
+		apiErr := &APIError{Endpoint: endpoint, Status: resp.StatusCode, Code: code}
+		switch {
+		case code != 0 && bitkubErrorMessages[code] != "":
+			apiErr.Message = bitkubErrorMessages[code]
+		case errorCheck.Message != "":
+			apiErr.Message = errorCheck.Message
+		default:
+			apiErr.Message = truncate(string(body), 200)
+		}
+		return nil, apiErr
+	}
+	return body, nil
+}
+
+// acquire waits for a free slot. Only the rate limit pause is cut short by
+// ctx; a slot frees up as soon as a request in flight returns.
+func (c *APIClient) acquire(ctx context.Context, limit int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for {
+		if wait := time.Until(c.pausedUntil); wait > 0 {
+			c.mu.Unlock()
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				c.mu.Lock()
+				return ctx.Err()
+			case <-timer.C:
+			}
+			c.mu.Lock()
+			continue
+		}
+		if c.inFlight < limit {
+			c.inFlight++
+			return nil
+		}
+		c.slotFree.Wait()
+	}
+}
+
+func (c *APIClient) release() {
+	c.mu.Lock()
+	c.inFlight--
+	c.mu.Unlock()
+	c.slotFree.Signal()
+}
+
+// pause holds back every call after a 429, by Retry-After when Bitkub sent
+// one and a second otherwise.
+func (c *APIClient) pause(retryAfter time.Duration) {
+	if retryAfter <= 0 {
+		retryAfter = time.Second
+	}
+	until := time.Now().Add(min(retryAfter, maxRetryAfter))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if until.After(c.pausedUntil) {
+		c.pausedUntil = until
+	}
+}
+
+func retryable(err error, idempotent bool) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		if apiErr.RateLimited() {
+			return apiErr.RetryAfter <= maxRetryAfter
+		}
+		return idempotent && apiErr.Temporary()
+	}
+
+	// A request that never connected was not seen by Bitkub.
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	return idempotent
+}
+
+// backoffDelay doubles with every attempt, and the jitter spreads out
+// retries that failed together. The shift is capped so a high attempt
+// count cannot overflow it.
+func backoffDelay(attempt int) time.Duration {
+	attempt = max(0, min(attempt, 20))
+	delay := min(retryBaseDelay<<attempt, retryMaxDelay)
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// parseRetryAfter reads a Retry-After header in seconds or as an HTTP date.
+func parseRetryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(header); err == nil {
+		return max(time.Until(at), 0)
+	}
+	return 0
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "…"
+}
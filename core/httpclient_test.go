@@ -0,0 +1,74 @@
+package core
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	for _, attempt := range []int{0, 1, 2, 4, 5, 10, 20, 34, 35, 63, 64, 1000} {
+		delay := min(retryBaseDelay<<min(attempt, 20), retryMaxDelay)
+		for i := 0; i < 20; i++ {
+			got := backoffDelay(attempt)
+			if got < delay/2 || got > delay {
+				t.Fatalf("backoffDelay(%d) = %s, want between %s and %s", attempt, got, delay/2, delay)
+			}
+		}
+	}
+	if got := backoffDelay(64); got < retryMaxDelay/2 {
+		t.Errorf("backoffDelay(64) = %s, want the capped delay", got)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		header string
+		want   time.Duration
+	}{
+		{"", 0},
+		{"5", 5 * time.Second},
+		{"0", 0},
+		{"-3", 0},
+		{"soon", 0},
+		{time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0},
+	}
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.header); got != tt.want {
+			t.Errorf("parseRetryAfter(%q) = %s, want %s", tt.header, got, tt.want)
+		}
+	}
+
+	date := time.Now().Add(30 * time.Second).UTC().Format(http.TimeFormat)
+	if got := parseRetryAfter(date); got < 28*time.Second || got > 30*time.Second {
+		t.Errorf("parseRetryAfter(%q) = %s, want about 30s", date, got)
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	dial := &net.OpError{Op: "dial", Err: errors.New("connection refused")}
+	read := &net.OpError{Op: "read", Err: errors.New("connection reset")}
+	tests := []struct {
+		name       string
+		err        error
+		idempotent bool
+		want       bool
+	}{
+		{"rate limited order", &APIError{Status: http.StatusTooManyRequests}, false, true},
+		{"rate limited too long", &APIError{Status: http.StatusTooManyRequests, RetryAfter: 2 * maxRetryAfter}, true, false},
+		{"server error read", &APIError{Status: 502}, true, true},
+		{"server error order", &APIError{Status: 502}, false, false},
+		{"bitkub server error code", &APIError{Status: 200, Code: 90}, true, true},
+		{"bad request", &APIError{Status: 400, Code: 18}, true, false},
+		{"failed dial order", dial, false, true},
+		{"network error read", read, true, true},
+		{"network error order", read, false, false},
+	}
+	for _, tt := range tests {
+		if got := retryable(tt.err, tt.idempotent); got != tt.want {
+			t.Errorf("%s: retryable = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
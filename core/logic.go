@@ -1,83 +1,70 @@
 package core
 
 import (
+	"context"
 	"fmt"
 	"math"
 	"sort"
+	"strings"
 	"time"
 )
 
-var LastCoinPrice float64
-
 func RoundFloat(val float64, precision int) float64 {
 	ratio := math.Pow(10, float64(precision))
 	return math.Round(val*ratio) / ratio
 }
 
-func fetchCurrentPrice(sym string) float64 {
-	if sym == "THB" {
-		return 1.0
-	}
-
-	price, err := FetchTickerPrice("THB_" + sym)
-	if err != nil {
-		fmt.Printf("Error fetching price for %s: %v\n", sym, err)
-		return 0.0
-	}
-	return price
+// CalculatePortfolio values the mode's wallet with fresh balances and prices,
+// which also refreshes the market data cache. ROI is measured against the
+// cash invested so far (see NetInvested), not just INITIAL_INVESTMENT.
+// It fails if the wallet or any target asset's price could not be read:
+// leaving an asset out would skew every other weight.
+func CalculatePortfolio(ex Exchange, mode string) (PortfolioSummary, error) {
+	return calculatePortfolio(ex, mode, 0)
 }
 
-func fetchCurrentBalance() map[string]float64 {
-	balances, err := FetchWalletBalance()
+// calculatePortfolio leaves reservedTHB (deposits waiting for DCA) out of
+// the THB balance.
+func calculatePortfolio(ex Exchange, mode string, reservedTHB float64) (PortfolioSummary, error) {
+	ConfigMutex.RLock()
+	targetAssets := copyFloats(TargetAssets)
+	ConfigMutex.RUnlock()
+
+	marketFetchMutex.Lock()
+	balance, prices, err := fetchMarketData(ex, mode, targetAssets)
+	marketFetchMutex.Unlock()
 	if err != nil {
-		fmt.Printf("Error fetching wallet balance: %v\n", err)
-		return map[string]float64{"THB": 0.0, CoinAsset: 0.0}
+		return PortfolioSummary{}, err
 	}
-	return balances
-}
+	balance["THB"] -= math.Min(reservedTHB, balance["THB"])
 
-func CalculatePortfolio() PortfolioSummary {
-	balance := fetchCurrentBalance()
-	coinPrice := fetchCurrentPrice(CoinAsset)
-	LastCoinPrice = coinPrice
+	return BuildPortfolio(balance, prices, targetAssets, NetInvested(mode)-reservedTHB), nil
+}
 
-	coinValue := balance[CoinAsset] * coinPrice
-	totalValue := balance["THB"] + coinValue
+// BuildPortfolio values the balances at the given prices and compares each
+// asset with its target weight. It does no I/O, so live trading and the
+// backtester share it.
+func BuildPortfolio(balance map[string]float64, prices map[string]float64, targetAssets map[string]float64, initialInvestment float64) PortfolioSummary {
+	totalValue := 0.0
+	for asset := range targetAssets {
+		totalValue += balance[asset] * prices[asset]
+	}
 
 	if totalValue < 0.00000001 {
 		totalValue = 1.0
 	}
 
 	roi := 0.0
-	if InitialInvestment > 0 {
-		roi = ((totalValue - float64(InitialInvestment)) / float64(InitialInvestment)) * 100.0
+	if initialInvestment > 0 {
+		roi = ((totalValue - initialInvestment) / initialInvestment) * 100.0
 	}
 
-	ConfigMutex.RLock()
-	targetAssets := TargetAssets
-	ConfigMutex.RUnlock()
-
 	portfolio := []AssetData{}
 
 	for asset, targetPercent := range targetAssets {
-		var assetValue float64
-		var price float64
-		var rawBalance float64
-
-		switch asset {
-		case "THB":
-			assetValue = balance["THB"]
-			price = 1.0
-			rawBalance = balance["THB"]
-		case CoinAsset:
-			assetValue = coinValue
-			price = coinPrice
-			rawBalance = balance[CoinAsset]
-		default:
-			assetValue = 0.0
-			price = 0.0
-			rawBalance = 0.0
-		}
+		price := prices[asset]
+		rawBalance := balance[asset]
+		assetValue := rawBalance * price
 
 		actualPercent := (assetValue / totalValue) * 100
 
@@ -99,87 +86,159 @@ func CalculatePortfolio() PortfolioSummary {
 	}
 }
 
-func RunRebalance() {
-	summary := CalculatePortfolio()
-	portfolio := summary.Portfolio
-	totalValue := summary.TotalValue
+// RunRebalance runs one rebalance check. Once ctx is cancelled no new order
+// is started, but an order already sent is always seen through to LogTrade.
+func RunRebalance(ctx context.Context, venue Venue) {
+	ex, dryRun := venue.Current()
+	mode := "PRODUCTION"
+	if dryRun {
+		mode = "DRY_RUN"
+	}
+
+	reservedTHB := runDCA(ctx, ex, mode)
+	summary, err := calculatePortfolio(ex, mode, reservedTHB)
+	if err != nil {
+		fmt.Printf("❌ ERROR: อ่านข้อมูลตลาดไม่ครบ ข้ามการ rebalance รอบนี้: %v\n", err)
+		publishError("Rebalance skipped, market data incomplete: %v", err)
+		return
+	}
+	RecordSnapshot(mode, summary, reservedTHB)
+	setMovePrices(summary)
 	ConfigMutex.RLock()
-	dryRun := IsDryRun
-	threshold := Threshold
+	minOrderTHB := MinOrderTHB
+	maxOrderTHB := MaxOrderTHB
+	maxTrades := MaxTradesPerRun
+	paperFeePct := PaperFeePct
 	ConfigMutex.RUnlock()
 
-	fmt.Printf("\n--- Rebalance Check (%s) | Total Value: %.2f THB | ROI: %.2f%% ---\n",
-		time.Now().Format("15:04:05"), totalValue, summary.ROI)
+	strategy, err := CurrentStrategy()
+	if err != nil {
+		fmt.Printf("❌ ERROR: %v\n", err)
+		publishError("Rebalance skipped: %v", err)
+		return
+	}
 
-	for _, assetData := range portfolio {
-		if assetData.Asset == "THB" {
+	fmt.Printf("\n--- Rebalance Check (%s) | Total Value: %.2f THB | ROI: %.2f%% | %s ---\n",
+		time.Now().Format("15:04:05"), summary.TotalValue, summary.ROI, strategy.Name())
+	if reservedTHB > 0 {
+		fmt.Printf("💧 ไม่นับเงินฝากที่รอ DCA %.2f THB ในการ rebalance\n", reservedTHB)
+	}
+
+	state := loadStrategyState(mode)
+	lastPeriod := state.LastPeriod
+	plans := strategy.Plan(summary, time.Now(), &state)
+
+	tradesSent := 0
+	feeSaved := 0.0
+	// incomplete counts trades that were planned but did not fully happen;
+	// while there are any, a periodic rebalance stays due.
+	incomplete := 0
+	for _, plan := range plans {
+		if plan.Operation == "" {
+			fmt.Printf("✅ %s: สัดส่วนปกติ (%.2f%%) | ไม่ต้อง Rebalance\n", plan.Asset, plan.ActualPct)
 			continue
 		}
-		deviation := math.Abs(assetData.ActualPct - assetData.TargetPct)
-		if deviation > threshold {
-			fmt.Printf("⚠️ %s: สัดส่วนจริง %.2f%% (เป้าหมาย %.2f%%) | เบี่ยงเบน %.2f%% > THRESHOLD\n",
-				assetData.Asset, assetData.ActualPct, assetData.TargetPct, deviation)
 
-			diff := assetData.ActualPct - assetData.TargetPct
-			operation := ""
-			amountToTrade := 0.0
+		fmt.Printf("⚠️ %s: สัดส่วนจริง %.2f%% (เป้าหมาย %.2f%%) | %s\n",
+			plan.Asset, plan.ActualPct, plan.TargetPct, plan.Reason)
 
-			if diff > 0 {
-				operation = "sell"
+		switch plan.Skip {
+		case SkipZeroPrice:
+			fmt.Printf("❌ ERROR: ราคา %s เป็นศูนย์. ไม่สามารถคำนวณปริมาณได้.\n", plan.Asset)
+			publishError("%s price is zero, skipped %s", plan.Asset, plan.Operation)
+			incomplete++
+			continue
+		case SkipBelowMinimum:
+			fmt.Printf("⏸️ SKIP: %s มูลค่า %.2f THB น้อยกว่าขั้นต่ำ %.2f THB\n", strings.ToUpper(plan.Operation), plan.AmountTHB, minOrderTHB)
+			incomplete++
+			continue
+		}
+
+		if ctx.Err() != nil {
+			fmt.Printf("🛑 Shutting down, skipping %s %s\n", plan.Operation, plan.Asset)
+			incomplete++
+			continue
+		}
+		if maxTrades > 0 && tradesSent >= maxTrades {
+			fmt.Printf("⏸️ SKIP: ส่งคำสั่งครบ %d รายการในรอบนี้แล้ว (MAX_TRADES_PER_RUN)\n", maxTrades)
+			incomplete++
+			continue
+		}
+		if plan.FullAmountTHB > plan.AmountTHB {
+			if dryRun {
+				saved := (plan.FullAmountTHB - plan.AmountTHB) * paperFeePct / 100.0
+				feeSaved += saved
+				fmt.Printf("✂️ PARTIAL: เทรด %.2f จาก %.2f THB ที่ต้องใช้กลับสู่เป้าหมาย (ประหยัดค่าธรรมเนียม ~%.2f THB)\n",
+					plan.AmountTHB, plan.FullAmountTHB, saved)
 			} else {
-				operation = "buy"
+				fmt.Printf("✂️ PARTIAL: เทรด %.2f จาก %.2f THB ที่ต้องใช้กลับสู่เป้าหมาย\n", plan.AmountTHB, plan.FullAmountTHB)
 			}
-			amountToTrade = (math.Abs(diff) / 100.0) * totalValue
-			amountToTrade = RoundFloat(amountToTrade, 2)
+		}
+		if maxOrderTHB > 0 && plan.AmountTHB > maxOrderTHB {
+			fmt.Printf("🛑 RISK: ลดขนาดคำสั่งจาก %.2f เหลือ %.2f THB (MAX_ORDER_THB)\n", plan.AmountTHB, maxOrderTHB)
+			plan.AmountTHB = maxOrderTHB
+			plan.CoinAmount = RoundFloat(maxOrderTHB/plan.Price, 8)
+			incomplete++
+		}
+		tradesSent++
 
-			if assetData.CurrentPrice <= 0 {
-				fmt.Printf("❌ ERROR: ราคา %s เป็นศูนย์. ไม่สามารถคำนวณปริมาณได้.\n", assetData.Asset)
-				continue
-			}
+		if dryRun {
+			fmt.Printf("🔥 DRY_RUN: จำลองคำสั่ง %s %.8f %s มูลค่า %.2f THB บนคู่ %s\n",
+				plan.Operation, plan.CoinAmount, plan.Asset, plan.AmountTHB, plan.Asset+"_THB")
+		} else {
+			fmt.Printf("✅ PRODUCTION: ส่งคำสั่ง %s %.8f %s (มูลค่า %.2f THB)\n", plan.Operation, plan.CoinAmount, plan.Asset, plan.AmountTHB)
+		}
 
-			coinAmount := amountToTrade / assetData.CurrentPrice
-			coinAmount = RoundFloat(coinAmount, 8)
-			var finalAmount float64
+		result, err := ExecutePlan(ctx, ex, plan)
+		amountTHB, coinAmount := plan.AmountTHB, plan.CoinAmount
+		if result.FilledAmount > 0 {
+			amountTHB, coinAmount = result.Amounts(plan.Operation)
+		}
 
-			if operation == "buy" {
-				if amountToTrade < 10.0 {
-					fmt.Printf("⏸️ SKIP: BUY มูลค่า %.2f THB น้อยกว่าขั้นต่ำ 10.00 THB\n", amountToTrade)
-					continue
-				}
-				finalAmount = amountToTrade
-			} else {
-				finalAmount = coinAmount
+		logMessage := ""
+		if err != nil {
+			logMessage = fmt.Sprintf("คำสั่งล้มเหลว: %v", err)
+			fmt.Printf("❌ ERROR: %s\n", logMessage)
+			publishError("%s %s %.2f THB failed: %v", plan.Operation, plan.Asset, plan.AmountTHB, err)
+			incomplete++
+		} else if result.Status == "unfilled" {
+			logMessage = fmt.Sprintf("คำสั่งไม่ถูกจับคู่: Order %s cancelled without a fill", result.OrderID)
+			fmt.Printf("⏸️ %s\n", logMessage)
+			incomplete++
+		} else {
+			if result.Status == "partial_filled" {
+				incomplete++
 			}
-			tradeSym := assetData.Asset + "_THB"
-
 			if dryRun {
-				mode := "DRY_RUN"
-				logMessage := fmt.Sprintf(
-					"จำลองคำสั่ง %s %.8f %s มูลค่า %.2f THB บนคู่ %s",
-					operation, coinAmount, assetData.Asset, amountToTrade, tradeSym)
-				fmt.Println("🔥 " + mode + ": " + logMessage)
-
-				SendDiscordTrade(assetData.Asset, operation, amountToTrade, coinAmount, assetData.CurrentPrice, "DRY_RUN")
-				LogTrade(assetData.Asset, operation, amountToTrade, coinAmount, assetData.CurrentPrice, mode, deviation, logMessage)
+				logMessage = fmt.Sprintf("จำลองคำสั่งสำเร็จ: Paper order %s (fee %.2f THB)", result.OrderID, result.Fee)
 			} else {
-				mode := "PRODUCTION"
-				fmt.Printf("✅ PRODUCTION: ส่งคำสั่ง %s %.8f %s (มูลค่า %.2f THB)\n", operation, coinAmount, assetData.Asset, amountToTrade)
-				err := SendOrder(tradeSym, finalAmount, operation)
-				logMessage := ""
-				if err != nil {
-					logMessage = fmt.Sprintf("คำสั่งล้มเหลว: %v", err)
-					fmt.Printf("❌ ERROR: %s\n", logMessage)
-				} else {
-					logMessage = "คำสั่งสำเร็จ: Order sent to Bitkub"
-					SendDiscordTrade(assetData.Asset, operation, amountToTrade, coinAmount, assetData.CurrentPrice, "PRODUCTION")
-				}
-
-				LogTrade(assetData.Asset, operation, amountToTrade, coinAmount, assetData.CurrentPrice, mode, deviation, logMessage)
+				logMessage = fmt.Sprintf("คำสั่งสำเร็จ: Order %s sent to Bitkub (%s)", result.OrderID, result.Status)
 			}
+			SendDiscordTrade(plan.Asset, plan.Operation, amountTHB, coinAmount, result.FillPrice, mode)
+		}
+
+		LogTrade(TradeLog{
+			Asset: plan.Asset, Operation: plan.Operation, AmountTHB: amountTHB, CoinAmount: coinAmount,
+			Price: plan.Price, FillPrice: result.FillPrice, Mode: mode, Deviation: plan.Deviation, LogMessage: logMessage,
+			OrderID: result.OrderID, OrderHash: result.OrderHash, Received: result.Received,
+			Fee: result.Fee, Credit: result.Credit, Rate: result.Rate,
+		})
+	}
+
+	if state.LastPeriod != lastPeriod {
+		if incomplete == 0 {
+			saveStrategyState(mode, state)
 		} else {
-			fmt.Printf("✅ %s: สัดส่วนปกติ (%.2f%%) | ไม่ต้อง Rebalance\n", assetData.Asset, assetData.ActualPct)
+			fmt.Printf("🔁 %d trade(s) of the %s rebalance did not go through, retrying on the next check\n", incomplete, state.LastPeriod)
 		}
 	}
+	if tradesSent > 0 {
+		// The dashboard should show the wallet after the trades, not before.
+		RefreshMarketData(ex, mode)
+	}
+	if feeSaved > 0 {
+		fmt.Printf("💰 DRY_RUN: partial rebalance ประหยัดค่าธรรมเนียมรอบนี้ ~%.2f THB (fee %.2f%%)\n", feeSaved, paperFeePct)
+	}
 }
 
 type ByTargetAndAsset []AssetData
@@ -194,9 +253,77 @@ func (p ByTargetAndAsset) Less(i, j int) bool {
 	return p[i].Asset < p[j].Asset
 }
 
-func StartBotLoop() {
+// StartBotLoop runs rebalance checks on RebalanceSchedule until ctx is
+// cancelled and returns after the check in progress has finished. The next
+// run is re-planned every few seconds while waiting, so schedule changes
+// from the dashboard or a config reload apply without a restart. A large
+// price move reported by the price feed runs an extra check in between,
+// unless it falls in a blackout window.
+func StartBotLoop(ctx context.Context, venue Venue) {
+	go keepMarketDataFresh(ctx, venue)
+	go runPriceFeed(ctx)
+	var lastTriggered time.Time
+
+	started := time.Now()
+	var last time.Time
+
+	plan := func() time.Time {
+		ConfigMutex.RLock()
+		schedule, interval := RebalanceSchedule, RebalanceInterval
+		ConfigMutex.RUnlock()
+
+		next := schedule.Next(interval, last, started, time.Now())
+		if !next.Equal(NextRun()) {
+			setNextRun(next)
+			fmt.Printf("🗓️ Next rebalance check at %s (%s)\n", next.Format("15:04:05 02/01/2006"), schedule.Describe(interval))
+		}
+		return next
+	}
+
 	for {
-		RunRebalance()
-		time.Sleep(1 * time.Minute)
+		next := plan()
+		for wait := time.Until(next); wait > 0; wait = time.Until(next) {
+			select {
+			case <-ctx.Done():
+				return
+			case reason := <-rebalanceTriggers:
+				if triggeredRebalanceAllowed(reason, lastTriggered) {
+					lastTriggered = time.Now()
+					RunRebalance(ctx, venue)
+				}
+			case <-time.After(min(wait, 5*time.Second)):
+			}
+			// Re-plan in case the config was reloaded, unless the slot is already due.
+			if time.Until(next) > 0 {
+				next = plan()
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		RunRebalance(ctx, venue)
+		last = next
+	}
+}
+
+// moveTriggerCooldown is the least time between two checks started by price
+// moves, so a volatile market cannot make the bot trade continuously.
+const moveTriggerCooldown = time.Minute
+
+func triggeredRebalanceAllowed(reason string, lastTriggered time.Time) bool {
+	ConfigMutex.RLock()
+	blackout := RebalanceSchedule.InBlackout(time.Now())
+	ConfigMutex.RUnlock()
+
+	switch {
+	case blackout:
+		fmt.Printf("⏸️ %s, but this is a blackout window; waiting for the next scheduled check\n", reason)
+		return false
+	case time.Since(lastTriggered) < moveTriggerCooldown:
+		fmt.Printf("⏸️ %s, but an early check ran less than %s ago\n", reason, moveTriggerCooldown)
+		return false
 	}
+	fmt.Printf("⚡ %s, running an early rebalance check\n", reason)
+	return true
 }
@@ -0,0 +1,255 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// marketData is the last wallet balances and prices read for a mode. When
+// a refresh fails the older data is kept and err records why.
+type marketData struct {
+	balances  map[string]float64
+	prices    map[string]float64
+	fetchedAt time.Time
+	err       error
+}
+
+var (
+	marketCache      = map[string]*marketData{}
+	marketCacheMutex sync.RWMutex
+	// marketFetchMutex lets one caller fetch while the others wait for its
+	// result, so several dashboard tabs never multiply the requests.
+	marketFetchMutex sync.Mutex
+
+	// marketLastRead is when a dashboard last read the cache, and
+	// marketWanted wakes keepMarketDataFresh when it read stale data.
+	marketLastRead  time.Time
+	marketReadMutex sync.Mutex
+	marketWanted    = make(chan struct{}, 1)
+)
+
+// dashboardIdleAfter is how long after the last dashboard read the cache
+// stops being kept fresh at MarketCacheTTL.
+const dashboardIdleAfter = time.Minute
+
+// MarketDataStatus tells a reader of the cache how old the data is.
+// Stale means it is older than MarketCacheTTL, i.e. the last refresh
+// failed or the bot loop is not running.
+type MarketDataStatus struct {
+	FetchedAt  time.Time `json:"fetched_at"`
+	AgeSeconds float64   `json:"age_seconds"`
+	Stale      bool      `json:"stale"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// fetchMarketData reads the wallet and the price of every target asset.
+// Prices streamed by the price feed within the cache TTL are used instead of
+// calling the ticker. The result is cached unless something could not be
+// read; then the error says what, and missing values are 0.
+func fetchMarketData(ex Exchange, mode string, targetAssets map[string]float64) (map[string]float64, map[string]float64, error) {
+	var fetchErr error
+	ConfigMutex.RLock()
+	ttl := MarketCacheTTL
+	ConfigMutex.RUnlock()
+
+	balances, err := ex.Balances()
+	if err != nil {
+		fmt.Printf("Error fetching wallet balance: %v\n", err)
+		fetchErr = fmt.Errorf("wallet: %w", err)
+		balances = map[string]float64{}
+	}
+	prices := make(map[string]float64, len(targetAssets))
+	for asset := range targetAssets {
+		if _, ok := balances[asset]; !ok {
+			balances[asset] = 0.0
+		}
+		if asset == "THB" {
+			prices[asset] = 1.0
+			continue
+		}
+		if price, ok := streamedPrice(asset, ttl); ok {
+			prices[asset] = price
+			continue
+		}
+		price, err := ex.Ticker(asset)
+		if err == nil && price <= 0 {
+			err = fmt.Errorf("ticker returned %v", price)
+		}
+		if err != nil {
+			fmt.Printf("Error fetching price for %s: %v\n", asset, err)
+			if fetchErr == nil {
+				fetchErr = fmt.Errorf("%s price: %w", asset, err)
+			}
+			price = 0
+		}
+		prices[asset] = price
+	}
+
+	marketCacheMutex.Lock()
+	defer marketCacheMutex.Unlock()
+	if fetchErr != nil {
+		if cached, ok := marketCache[mode]; ok {
+			cached.err = fetchErr
+		}
+		publishError("Market data (%s): %v", mode, fetchErr)
+		return balances, prices, fetchErr
+	}
+	marketCache[mode] = &marketData{balances: copyFloats(balances), prices: copyFloats(prices), fetchedAt: time.Now()}
+	notifyPortfolioChanged()
+	return balances, prices, nil
+}
+
+// RefreshMarketData re-reads the mode's balances and prices into the cache.
+func RefreshMarketData(ex Exchange, mode string) {
+	ConfigMutex.RLock()
+	targetAssets := copyFloats(TargetAssets)
+	ConfigMutex.RUnlock()
+
+	marketFetchMutex.Lock()
+	defer marketFetchMutex.Unlock()
+	fetchMarketData(ex, mode, targetAssets)
+}
+
+// CachedPortfolio values the mode's wallet from the cache. Bitkub is only
+// called when nothing usable is cached yet, e.g. right after startup or a
+// mode switch, or when a new asset was added to the targets.
+func CachedPortfolio(ex Exchange, mode string) (PortfolioSummary, map[string]float64, MarketDataStatus) {
+	ConfigMutex.RLock()
+	targetAssets := copyFloats(TargetAssets)
+	ttl := MarketCacheTTL
+	ConfigMutex.RUnlock()
+
+	marketReadMutex.Lock()
+	marketLastRead = time.Now()
+	marketReadMutex.Unlock()
+
+	data, ok := cachedMarketData(mode, targetAssets)
+	if ok && time.Since(data.fetchedAt) > ttl {
+		select {
+		case marketWanted <- struct{}{}:
+		default:
+		}
+	}
+	if !ok {
+		marketFetchMutex.Lock()
+		// Another caller may have fetched while this one waited.
+		if data, ok = cachedMarketData(mode, targetAssets); !ok {
+			fetchMarketData(ex, mode, targetAssets)
+			data, ok = cachedMarketData(mode, targetAssets)
+		}
+		marketFetchMutex.Unlock()
+	}
+
+	if !ok {
+		// Nothing could be read; value what there is so the page still loads.
+		status := MarketDataStatus{Stale: true, Error: "market data unavailable"}
+		if data.err != nil {
+			status.Error = data.err.Error()
+		}
+		return BuildPortfolio(data.balances, data.prices, targetAssets, NetInvested(mode)), data.prices, status
+	}
+
+	age := time.Since(data.fetchedAt)
+	status := MarketDataStatus{
+		FetchedAt:  data.fetchedAt,
+		AgeSeconds: RoundFloat(age.Seconds(), 1),
+		Stale:      age > ttl,
+	}
+	if data.err != nil {
+		status.Error = data.err.Error()
+	}
+	return BuildPortfolio(data.balances, data.prices, targetAssets, NetInvested(mode)), data.prices, status
+}
+
+// cachedMarketData returns a copy of the cache entry and whether it covers
+// every target asset.
+func cachedMarketData(mode string, targetAssets map[string]float64) (marketData, bool) {
+	marketCacheMutex.RLock()
+	defer marketCacheMutex.RUnlock()
+
+	cached, ok := marketCache[mode]
+	if !ok {
+		return marketData{}, false
+	}
+	data := marketData{balances: copyFloats(cached.balances), prices: copyFloats(cached.prices), fetchedAt: cached.fetchedAt, err: cached.err}
+	for asset := range targetAssets {
+		if _, ok := data.prices[asset]; !ok {
+			return data, false
+		}
+	}
+	return data, true
+}
+
+// marketDataAge is how long ago the mode's data was fetched. Without any
+// data it is older than any TTL.
+func marketDataAge(mode string) time.Duration {
+	marketCacheMutex.RLock()
+	defer marketCacheMutex.RUnlock()
+	if cached, ok := marketCache[mode]; ok {
+		return time.Since(cached.fetchedAt)
+	}
+	return time.Duration(1<<63 - 1)
+}
+
+// dropMarketData forgets a mode's cached wallet after it was changed
+// outside an exchange call (paper deposits, a paper wallet reset).
+func dropMarketData(mode string) {
+	marketCacheMutex.Lock()
+	delete(marketCache, mode)
+	marketCacheMutex.Unlock()
+	notifyPortfolioChanged()
+}
+
+// keepMarketDataFresh refreshes the current mode's cache whenever it is
+// older than MarketCacheTTL while a dashboard is watching (an open stream
+// or a read within dashboardIdleAfter). With nobody watching it only keeps
+// the data as fresh as the bot interval. Rebalance checks refresh it too,
+// so between them this only fills the gaps.
+func keepMarketDataFresh(ctx context.Context, venue Venue) {
+	for {
+		ex, dryRun := venue.Current()
+		mode := "PRODUCTION"
+		if dryRun {
+			mode = "DRY_RUN"
+		}
+		ConfigMutex.RLock()
+		ttl, interval := MarketCacheTTL, RebalanceInterval
+		ConfigMutex.RUnlock()
+		if !dashboardWatching() {
+			ttl = max(ttl, interval)
+		}
+
+		wait := ttl - marketDataAge(mode)
+		if wait <= 0 {
+			RefreshMarketData(ex, mode)
+			wait = ttl
+		}
+
+		// Wake up at least every few seconds to follow mode and TTL changes.
+		select {
+		case <-ctx.Done():
+			return
+		case <-marketWanted:
+		case <-time.After(min(wait, 5*time.Second)):
+		}
+	}
+}
+
+func dashboardWatching() bool {
+	if EventSubscribers() > 0 {
+		return true
+	}
+	marketReadMutex.Lock()
+	defer marketReadMutex.Unlock()
+	return time.Since(marketLastRead) < dashboardIdleAfter
+}
+
+func copyFloats(m map[string]float64) map[string]float64 {
+	out := make(map[string]float64, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
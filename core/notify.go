@@ -5,11 +5,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
 )
 
 func SendDiscordStartup() {
-	if DiscordWebhookURL == "" {
+	if discordWebhookURL() == "" {
 		return
 	}
 
@@ -33,6 +35,7 @@ func SendDiscordStartup() {
 				"fields": []map[string]interface{}{
 					{"name": "Initial Investment", "value": fmt.Sprintf("%.2f THB", InitialInvestment), "inline": true},
 					{"name": "Rebalance Threshold", "value": fmt.Sprintf("%.2f%%", Threshold), "inline": true},
+					{"name": "Target Weights", "value": FormatTargets(TargetAssets), "inline": false},
 					{"name": "Time", "value": time.Now().Format("15:04:05 02/01/2006"), "inline": false},
 				},
 				"footer": map[string]interface{}{
@@ -47,7 +50,7 @@ func SendDiscordStartup() {
 }
 
 func SendDiscordTrade(asset, operation string, amountTHB, coinAmount, price float64, mode string) {
-	if DiscordWebhookURL == "" {
+	if discordWebhookURL() == "" {
 		return
 	}
 
@@ -82,11 +85,41 @@ func SendDiscordTrade(asset, operation string, amountTHB, coinAmount, price floa
 	sendToDiscord(payload)
 }
 
+// discordWebhookURL reads the webhook under ConfigMutex since a config
+// reload may replace it.
+func discordWebhookURL() string {
+	ConfigMutex.RLock()
+	defer ConfigMutex.RUnlock()
+	return DiscordWebhookURL
+}
+
+var (
+	discordClient = &http.Client{Timeout: 10 * time.Second}
+
+	// discordSends tracks webhook posts still in flight so shutdown can wait
+	// for them instead of dropping the last notifications. Once draining is
+	// set new posts are dropped, so Add never races with the Wait in
+	// DrainDiscord.
+	discordSends    sync.WaitGroup
+	discordMutex    sync.Mutex
+	discordDraining bool
+)
+
 func sendToDiscord(payload map[string]interface{}) {
 	jsonPayload, _ := json.Marshal(payload)
-	
+
+	discordMutex.Lock()
+	if discordDraining {
+		discordMutex.Unlock()
+		fmt.Println("⚠️ Shutting down, Discord notification dropped")
+		return
+	}
+	discordSends.Add(1)
+	discordMutex.Unlock()
+
 	go func() {
-		resp, err := http.Post(DiscordWebhookURL, "application/json", bytes.NewBuffer(jsonPayload))
+		defer discordSends.Done()
+		resp, err := discordClient.Post(discordWebhookURL(), "application/json", bytes.NewBuffer(jsonPayload))
 		if err != nil {
 			fmt.Println("❌ Failed to send Discord webhook:", err)
 			return
@@ -95,8 +128,29 @@ func sendToDiscord(payload map[string]interface{}) {
 	}()
 }
 
+// DrainDiscord waits up to timeout for pending webhook posts and reports
+// whether they all finished. Posts made after it is called are dropped.
+func DrainDiscord(timeout time.Duration) bool {
+	discordMutex.Lock()
+	discordDraining = true
+	discordMutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		discordSends.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
 func SendDiscordModeChange(isDryRun bool) {
-	if DiscordWebhookURL == "" {
+	if discordWebhookURL() == "" {
 		return
 	}
 
@@ -127,4 +181,94 @@ func SendDiscordModeChange(isDryRun bool) {
 	}
 
 	sendToDiscord(payload)
-}
\ No newline at end of file
+}
+
+func SendDiscordSettingsChange(old RuntimeSettings, updated RuntimeSettings, actor string) {
+	if discordWebhookURL() == "" {
+		return
+	}
+
+	payload := map[string]interface{}{
+		"username": "Bitkub Bot",
+		"embeds": []map[string]interface{}{
+			{
+				"title":       "⚙️ Settings Changed",
+				"description": fmt.Sprintf("แก้ไขการตั้งค่าโดย **%s**", actor),
+				"color":       0x00a8ff,
+				"fields": []map[string]interface{}{
+					{"name": "Target Weights", "value": fmt.Sprintf("%s → %s", FormatTargets(old.Targets), FormatTargets(updated.Targets)), "inline": false},
+					{"name": "Threshold", "value": fmt.Sprintf("%.2f%% → %.2f%%", old.Threshold, updated.Threshold), "inline": true},
+					{"name": "Interval", "value": fmt.Sprintf("%ds → %ds", old.IntervalSeconds, updated.IntervalSeconds), "inline": true},
+					{"name": "Min Order", "value": fmt.Sprintf("%.2f → %.2f THB", old.MinOrderTHB, updated.MinOrderTHB), "inline": true},
+					{"name": "Time", "value": time.Now().Format("15:04:05 02/01/2006"), "inline": false},
+				},
+				"footer": map[string]interface{}{
+					"text": "Bitkub Rebalance Bot",
+				},
+			},
+		},
+	}
+
+	sendToDiscord(payload)
+}
+
+func SendDiscordConfigReload(trigger string, changes []string, reloadErr error) {
+	if discordWebhookURL() == "" {
+		return
+	}
+
+	title := "♻️ Config Reloaded"
+	description := "• " + strings.Join(changes, "\n• ")
+	color := 0x00a8ff
+	if reloadErr != nil {
+		title = "❌ Config Reload Rejected"
+		description = fmt.Sprintf("การตั้งค่าใหม่ไม่ผ่านการตรวจสอบ ยังใช้ค่าเดิมอยู่\n```%v```", reloadErr)
+		color = 0xff0000
+	}
+
+	payload := map[string]interface{}{
+		"username": "Bitkub Bot",
+		"embeds": []map[string]interface{}{
+			{
+				"title":       title,
+				"description": description,
+				"color":       color,
+				"fields": []map[string]interface{}{
+					{"name": "Trigger", "value": trigger, "inline": true},
+					{"name": "Time", "value": time.Now().Format("15:04:05 02/01/2006"), "inline": true},
+				},
+				"footer": map[string]interface{}{
+					"text": "Bitkub Rebalance Bot",
+				},
+			},
+		},
+	}
+
+	sendToDiscord(payload)
+}
+
+func SendDiscordShutdown(reason string) {
+	if discordWebhookURL() == "" {
+		return
+	}
+
+	payload := map[string]interface{}{
+		"username": "Bitkub Bot",
+		"embeds": []map[string]interface{}{
+			{
+				"title":       "🛑 Bot Stopped",
+				"description": "บอทหยุดทำงานแล้ว ไม่มีคำสั่งค้างระหว่างส่ง",
+				"color":       0x808080,
+				"fields": []map[string]interface{}{
+					{"name": "Reason", "value": reason, "inline": true},
+					{"name": "Time", "value": time.Now().Format("15:04:05 02/01/2006"), "inline": true},
+				},
+				"footer": map[string]interface{}{
+					"text": "Bitkub Rebalance Bot",
+				},
+			},
+		},
+	}
+
+	sendToDiscord(payload)
+}
@@ -0,0 +1,217 @@
+package core
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// PaperExchange simulates a wallet for DRY_RUN. Prices come from the market
+// exchange it wraps; balances live in the paper_wallet table so the
+// simulation carries on across restarts.
+type PaperExchange struct {
+	Market      Exchange
+	FeePct      float64
+	SlippagePct float64
+
+	mu     sync.Mutex
+	orders map[string]*paperOrder
+	nextID int
+}
+
+func NewPaperExchange(market Exchange, feePct float64, slippagePct float64) *PaperExchange {
+	return &PaperExchange{
+		Market:      market,
+		FeePct:      feePct,
+		SlippagePct: slippagePct,
+		orders:      map[string]*paperOrder{},
+	}
+}
+
+func (p *PaperExchange) Name() string { return "paper" }
+
+func (p *PaperExchange) Ticker(asset string) (float64, error) {
+	return p.Market.Ticker(asset)
+}
+
+func (p *PaperExchange) Quote(asset string) (Quote, error) {
+	return p.Market.Quote(asset)
+}
+
+func (p *PaperExchange) Balances() (map[string]float64, error) {
+	paperWalletMutex.Lock()
+	defer paperWalletMutex.Unlock()
+	return loadPaperWallet()
+}
+
+// paperOrder is a paper order with the request it was placed from, which an
+// open limit order needs to fill later.
+type paperOrder struct {
+	req  OrderRequest
+	info OrderInfo
+}
+
+// PlaceOrder fills market orders immediately at the ask (buys) or bid
+// (sells) plus slippage. A limit order fills at the book price only when
+// its rate crosses it; otherwise it stays open until the market reaches the
+// rate (checked on OrderInfo) or it is cancelled, like on Bitkub.
+func (p *PaperExchange) PlaceOrder(req OrderRequest) (Order, error) {
+	if req.Amount <= 0 {
+		return Order{}, fmt.Errorf("cannot send order with non-positive amount: %.8f", req.Amount)
+	}
+
+	quote, err := p.Market.Quote(req.Asset)
+	if err != nil {
+		return Order{}, err
+	}
+	price := quote.Ask
+	if req.Side == "sell" {
+		price = quote.Bid
+	}
+	limit := req.Type == "limit" && req.Rate > 0
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.nextID++
+	order := Order{
+		ID:        fmt.Sprintf("paper-%d-%d", time.Now().Unix(), p.nextID),
+		Asset:     req.Asset,
+		Side:      req.Side,
+		Type:      req.Type,
+		Rate:      req.Rate,
+		Amount:    req.Amount,
+		Timestamp: time.Now(),
+	}
+
+	if limit && !crosses(req.Side, req.Rate, quote) {
+		p.orders[order.ID] = &paperOrder{req: req, info: OrderInfo{
+			ID: order.ID, Side: req.Side, Status: "open", Amount: req.Amount, Remaining: req.Amount, Rate: req.Rate,
+		}}
+		return order, nil
+	}
+
+	slippagePct := p.SlippagePct
+	if limit {
+		slippagePct = 0
+	}
+	fill, err := p.fill(req, price, slippagePct)
+	if err != nil {
+		return Order{}, err
+	}
+
+	order.Rate = fill.Price
+	order.Fee = fill.Fee
+	if req.Side == "buy" {
+		order.Amount = fill.AmountTHB
+		order.Received = fill.CoinAmount
+	} else {
+		order.Amount = fill.CoinAmount
+		order.Received = fill.AmountTHB - fill.Fee
+	}
+	// Only limit orders are looked up afterwards.
+	if limit {
+		p.orders[order.ID] = &paperOrder{req: req, info: filledInfo(order.ID, req.Side, order.Amount, fill)}
+	}
+	return order, nil
+}
+
+// crosses reports whether a limit order at rate can trade against quote.
+func crosses(side string, rate float64, quote Quote) bool {
+	if side == "buy" {
+		return quote.Ask > 0 && rate >= quote.Ask
+	}
+	return quote.Bid > 0 && rate <= quote.Bid
+}
+
+func filledInfo(id string, side string, amount float64, fill SimulatedFill) OrderInfo {
+	return OrderInfo{
+		ID:       id,
+		Side:     side,
+		Status:   "filled",
+		Amount:   amount,
+		Filled:   amount,
+		Rate:     fill.Price,
+		Fee:      fill.Fee,
+		AvgPrice: fill.Price,
+	}
+}
+
+// OrderInfo fills an open limit order at its rate once the market has
+// reached it. An order is forgotten once its final state has been read.
+func (p *PaperExchange) OrderInfo(asset string, side string, orderID string) (OrderInfo, error) {
+	p.mu.Lock()
+	order, ok := p.orders[orderID]
+	open := ok && order.info.Status == "open"
+	p.mu.Unlock()
+	if !ok {
+		return OrderInfo{}, fmt.Errorf("paper order %s not found", orderID)
+	}
+
+	if open {
+		quote, err := p.Market.Quote(order.req.Asset)
+		if err != nil {
+			return OrderInfo{}, err
+		}
+		p.mu.Lock()
+		if order.info.Status == "open" && crosses(order.req.Side, order.req.Rate, quote) {
+			fill, err := p.fill(order.req, order.req.Rate, 0)
+			if err != nil {
+				// Nothing is reserved for open paper orders, so the wallet may
+				// no longer cover this one.
+				fmt.Printf("⚠️ Paper order %s could not fill: %v\n", orderID, err)
+				order.info.Status = "cancelled"
+			} else {
+				amount := fill.AmountTHB
+				if order.req.Side == "sell" {
+					amount = fill.CoinAmount
+				}
+				order.info = filledInfo(orderID, order.req.Side, amount, fill)
+			}
+		}
+		p.mu.Unlock()
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	info := order.info
+	if info.Status == "filled" || info.Status == "cancelled" {
+		delete(p.orders, orderID)
+	}
+	return info, nil
+}
+
+func (p *PaperExchange) CancelOrder(asset string, side string, orderID string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	order, ok := p.orders[orderID]
+	if !ok {
+		return fmt.Errorf("paper order %s not found", orderID)
+	}
+	if order.info.Status != "open" {
+		return fmt.Errorf("paper order %s is already %s", orderID, order.info.Status)
+	}
+	order.info.Status = "cancelled"
+	return nil
+}
+
+// fill applies the order to the stored wallet while holding
+// paperWalletMutex, so a deposit made at the same time is not lost.
+func (p *PaperExchange) fill(req OrderRequest, price float64, slippagePct float64) (SimulatedFill, error) {
+	paperWalletMutex.Lock()
+	defer paperWalletMutex.Unlock()
+
+	balances, err := loadPaperWallet()
+	if err != nil {
+		return SimulatedFill{}, err
+	}
+	fill, err := simulateFill(balances, req.Asset, req.Side, req.Amount, price, p.FeePct, slippagePct)
+	if err != nil {
+		return SimulatedFill{}, err
+	}
+	if err := savePaperWallet(balances); err != nil {
+		return SimulatedFill{}, err
+	}
+	return fill, nil
+}
@@ -0,0 +1,379 @@
+package core
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// PriceFeed streams prices from Bitkub's public WebSocket API. It follows
+// the ticker and trade streams of every asset; each message that carries a
+// price is passed to OnPrice. URL is the base of the stream URLs, so a
+// local fake server can stand in for Bitkub.
+type PriceFeed struct {
+	URL       string
+	Assets    []string
+	Heartbeat time.Duration
+	OnPrice   func(asset string, price float64, at time.Time)
+}
+
+// streamMessage covers the fields the ticker ("last") and trade ("rat")
+// streams are read for.
+type streamMessage struct {
+	Stream string    `json:"stream"`
+	Last   flexFloat `json:"last"`
+	Rate   flexFloat `json:"rat"`
+}
+
+// StreamURL is the URL subscribing to every stream the feed follows.
+func (f *PriceFeed) StreamURL() string {
+	streams := []string{}
+	for _, asset := range f.Assets {
+		sym := "thb_" + strings.ToLower(asset)
+		streams = append(streams, "market.ticker."+sym, "market.trade."+sym)
+	}
+	return strings.TrimRight(f.URL, "/") + "/" + strings.Join(streams, ",")
+}
+
+// Run holds one connection until it fails or ctx is cancelled. A ping is
+// sent every Heartbeat, and a connection that receives nothing for three
+// heartbeats, not even a pong, is treated as dead. A quiet pair with no
+// ticker or trade messages stays connected as long as pongs come back.
+func (f *PriceFeed) Run(ctx context.Context) error {
+	config, err := websocket.NewConfig(f.StreamURL(), "http://localhost/")
+	if err != nil {
+		return err
+	}
+	raw, err := dialFeed(ctx, config)
+	if err != nil {
+		return err
+	}
+	live := &liveConn{Conn: raw, timeout: 3 * f.Heartbeat}
+	live.SetReadDeadline(time.Now().Add(live.timeout))
+
+	stop := context.AfterFunc(ctx, func() { raw.Close() })
+	conn, err := websocket.NewClient(config, live)
+	stop()
+	if err != nil {
+		raw.Close()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+	defer conn.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(f.Heartbeat)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				// Unblocks the read below.
+				conn.Close()
+				return
+			case <-done:
+				return
+			case <-ticker.C:
+				conn.SetWriteDeadline(time.Now().Add(f.Heartbeat))
+				conn.PayloadType = websocket.PingFrame
+				if _, err := conn.Write([]byte("ping")); err != nil {
+					conn.Close()
+					return
+				}
+			}
+		}
+	}()
+
+	for {
+		var frame string
+		if err := websocket.Message.Receive(conn, &frame); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		f.handleFrame(frame)
+	}
+}
+
+// liveConn pushes the read deadline forward whenever any bytes arrive.
+// websocket.Conn answers pings and swallows pongs inside Receive, so this is
+// the only place a pong can be seen.
+type liveConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c *liveConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+	}
+	return n, err
+}
+
+// dialFeed opens the TCP (ws) or TLS (wss) connection the WebSocket runs on.
+func dialFeed(ctx context.Context, config *websocket.Config) (net.Conn, error) {
+	u := config.Location
+	dialer := &net.Dialer{}
+	switch u.Scheme {
+	case "ws":
+		port := u.Port()
+		if port == "" {
+			port = "80"
+		}
+		return dialer.DialContext(ctx, "tcp", net.JoinHostPort(u.Hostname(), port))
+	case "wss":
+		port := u.Port()
+		if port == "" {
+			port = "443"
+		}
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: config.TlsConfig}
+		return tlsDialer.DialContext(ctx, "tcp", net.JoinHostPort(u.Hostname(), port))
+	}
+	return nil, websocket.ErrBadScheme
+}
+
+// handleFrame reads every message in a frame; Bitkub may send several,
+// separated by newlines.
+func (f *PriceFeed) handleFrame(frame string) {
+	dec := json.NewDecoder(strings.NewReader(frame))
+	for {
+		var msg streamMessage
+		if err := dec.Decode(&msg); err != nil {
+			if err != io.EOF {
+				fmt.Printf("⚠️ Price feed: unreadable message: %v\n", err)
+			}
+			return
+		}
+
+		price := float64(msg.Last)
+		if strings.HasPrefix(msg.Stream, "market.trade.") {
+			price = float64(msg.Rate)
+		}
+		_, sym, ok := strings.Cut(msg.Stream[strings.LastIndex(msg.Stream, ".")+1:], "_")
+		if !ok || price <= 0 {
+			continue
+		}
+		if f.OnPrice != nil {
+			f.OnPrice(strings.ToUpper(sym), price, time.Now())
+		}
+	}
+}
+
+type livePrice struct {
+	price float64
+	at    time.Time
+}
+
+var (
+	livePrices     = map[string]livePrice{}
+	movePrices     = map[string]float64{}
+	livePriceMutex sync.RWMutex
+
+	feedConnected   bool
+	feedLastMessage time.Time
+
+	// rebalanceTriggers asks the bot loop for an early check. It holds one
+	// request; more while that one is pending add nothing.
+	rebalanceTriggers = make(chan string, 1)
+)
+
+// PriceFeedStatus is the state of the WebSocket feed for the dashboard.
+type PriceFeedStatus struct {
+	Enabled     bool      `json:"enabled"`
+	Connected   bool      `json:"connected"`
+	LastMessage time.Time `json:"last_message"`
+}
+
+// CurrentPriceFeedStatus reports whether live prices are coming in.
+func CurrentPriceFeedStatus() PriceFeedStatus {
+	ConfigMutex.RLock()
+	enabled := MarketWSEnabled
+	ConfigMutex.RUnlock()
+
+	livePriceMutex.RLock()
+	defer livePriceMutex.RUnlock()
+	return PriceFeedStatus{Enabled: enabled, Connected: feedConnected, LastMessage: feedLastMessage}
+}
+
+// streamedPrice returns the asset's price from the feed if it is younger
+// than maxAge.
+func streamedPrice(asset string, maxAge time.Duration) (float64, bool) {
+	livePriceMutex.RLock()
+	defer livePriceMutex.RUnlock()
+	p, ok := livePrices[asset]
+	if !ok || time.Since(p.at) > maxAge {
+		return 0, false
+	}
+	return p.price, true
+}
+
+// setMovePrices records the prices a rebalance check saw; moves are
+// measured from them.
+func setMovePrices(summary PortfolioSummary) {
+	livePriceMutex.Lock()
+	defer livePriceMutex.Unlock()
+	for _, asset := range summary.Portfolio {
+		if asset.Asset != "THB" && asset.CurrentPrice > 0 {
+			movePrices[asset.Asset] = asset.CurrentPrice
+		}
+	}
+}
+
+// onStreamedPrice stores a price from the feed, updates the cached prices
+// the dashboard reads and asks for an early check on a large move.
+func onStreamedPrice(asset string, price float64, at time.Time) {
+	ConfigMutex.RLock()
+	triggerPct := MoveTriggerPct
+	ConfigMutex.RUnlock()
+
+	livePriceMutex.Lock()
+	livePrices[asset] = livePrice{price: price, at: at}
+	feedLastMessage = at
+	reason := ""
+	if ref := movePrices[asset]; triggerPct > 0 && ref > 0 {
+		if move := (price - ref) / ref * 100.0; math.Abs(move) >= triggerPct {
+			reason = fmt.Sprintf("%s moved %+.2f%% to %.2f THB", asset, move, price)
+			// Measure the next move from here, so one move asks only once.
+			movePrices[asset] = price
+		}
+	}
+	livePriceMutex.Unlock()
+
+	marketCacheMutex.Lock()
+	for _, cached := range marketCache {
+		if _, ok := cached.prices[asset]; ok {
+			cached.prices[asset] = price
+		}
+	}
+	marketCacheMutex.Unlock()
+	notifyPortfolioChanged()
+
+	if reason != "" {
+		select {
+		case rebalanceTriggers <- reason:
+		default:
+		}
+	}
+}
+
+func setFeedConnected(connected bool) {
+	livePriceMutex.Lock()
+	feedConnected = connected
+	livePriceMutex.Unlock()
+}
+
+// Reconnect backoff for the price feed. Variables so tests can run it
+// faster.
+var (
+	feedBackoffMin = time.Second
+	feedBackoffMax = time.Minute
+)
+
+// feedSettings is what a connection is built from; when it changes the
+// connection is replaced.
+type feedSettings struct {
+	enabled   bool
+	url       string
+	assets    string
+	heartbeat time.Duration
+}
+
+func currentFeedSettings() feedSettings {
+	ConfigMutex.RLock()
+	defer ConfigMutex.RUnlock()
+
+	assets := []string{}
+	for asset := range TargetAssets {
+		if asset != "THB" {
+			assets = append(assets, asset)
+		}
+	}
+	sort.Strings(assets)
+	return feedSettings{enabled: MarketWSEnabled, url: MarketWSURL, assets: strings.Join(assets, ","), heartbeat: MarketWSHeartbeat}
+}
+
+// runPriceFeed keeps the price feed connected while MARKET_WS_ENABLED is
+// on, reconnecting with exponential backoff and jitter. Config reloads and
+// target changes reconnect with the new streams.
+func runPriceFeed(ctx context.Context) {
+	backoff := feedBackoffMin
+	for ctx.Err() == nil {
+		settings := currentFeedSettings()
+		if !settings.enabled || settings.assets == "" {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(5 * time.Second):
+			}
+			continue
+		}
+
+		connCtx, cancel := context.WithCancel(ctx)
+		go func() {
+			for {
+				select {
+				case <-connCtx.Done():
+					return
+				case <-time.After(5 * time.Second):
+					if currentFeedSettings() != settings {
+						fmt.Println("🔄 Price feed settings changed, reconnecting")
+						cancel()
+						return
+					}
+				}
+			}
+		}()
+
+		feed := &PriceFeed{
+			URL:       settings.url,
+			Assets:    strings.Split(settings.assets, ","),
+			Heartbeat: settings.heartbeat,
+			OnPrice: func(asset string, price float64, at time.Time) {
+				setFeedConnected(true)
+				onStreamedPrice(asset, price, at)
+			},
+		}
+		fmt.Printf("📡 Price feed connecting to %s (%s)\n", settings.url, settings.assets)
+		started := time.Now()
+		err := feed.Run(connCtx)
+		setFeedConnected(false)
+		replaced := connCtx.Err() != nil && ctx.Err() == nil
+		cancel()
+
+		if ctx.Err() != nil {
+			return
+		}
+		if replaced {
+			backoff = feedBackoffMin
+			continue
+		}
+		// A connection that held for a while starts the backoff over.
+		if time.Since(started) > time.Minute {
+			backoff = feedBackoffMin
+		}
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff)))
+		fmt.Printf("⚠️ Price feed disconnected: %v, reconnecting in %s\n", err, wait.Round(100*time.Millisecond))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+		backoff = min(backoff*2, feedBackoffMax)
+	}
+}
@@ -0,0 +1,296 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+type tick struct {
+	asset string
+	price float64
+}
+
+// fakeBitkub serves handler as a WebSocket server and returns its ws:// URL.
+func fakeBitkub(t *testing.T, handler func(*websocket.Conn)) string {
+	t.Helper()
+	srv := httptest.NewServer(websocket.Handler(handler))
+	t.Cleanup(srv.Close)
+	return "ws://" + strings.TrimPrefix(srv.URL, "http://")
+}
+
+// useFeedConfig points the bot's feed settings at url for one test.
+func useFeedConfig(t *testing.T, url string, heartbeat time.Duration, triggerPct float64) {
+	t.Helper()
+	ConfigMutex.Lock()
+	enabled, oldURL, oldHeartbeat, oldTrigger, oldTargets := MarketWSEnabled, MarketWSURL, MarketWSHeartbeat, MoveTriggerPct, TargetAssets
+	MarketWSEnabled, MarketWSURL, MarketWSHeartbeat, MoveTriggerPct = true, url, heartbeat, triggerPct
+	TargetAssets = map[string]float64{"THB": 50, "BTC": 50}
+	ConfigMutex.Unlock()
+
+	livePriceMutex.Lock()
+	livePrices, movePrices = map[string]livePrice{}, map[string]float64{}
+	livePriceMutex.Unlock()
+	drainTriggers()
+
+	t.Cleanup(func() {
+		ConfigMutex.Lock()
+		MarketWSEnabled, MarketWSURL, MarketWSHeartbeat, MoveTriggerPct, TargetAssets = enabled, oldURL, oldHeartbeat, oldTrigger, oldTargets
+		ConfigMutex.Unlock()
+	})
+}
+
+func drainTriggers() {
+	for {
+		select {
+		case <-rebalanceTriggers:
+		default:
+			return
+		}
+	}
+}
+
+func TestHandleFrame(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame string
+		want  []tick
+	}{
+		{"ticker", `{"stream":"market.ticker.thb_btc","last":2000000.5}`, []tick{{"BTC", 2000000.5}}},
+		{"ticker as string", `{"stream":"market.ticker.thb_eth","last":"85000"}`, []tick{{"ETH", 85000}}},
+		{"trade uses rate", `{"stream":"market.trade.thb_btc","rat":"1999000","last":1}`, []tick{{"BTC", 1999000}}},
+		{"several messages", "{\"stream\":\"market.ticker.thb_btc\",\"last\":1}\n{\"stream\":\"market.trade.thb_eth\",\"rat\":2}",
+			[]tick{{"BTC", 1}, {"ETH", 2}}},
+		{"zero price", `{"stream":"market.ticker.thb_btc","last":0}`, nil},
+		{"no stream", `{"last":5}`, nil},
+		{"unreadable rest", `{"stream":"market.ticker.thb_btc","last":3}` + "\nnot json", []tick{{"BTC", 3}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []tick
+			feed := &PriceFeed{OnPrice: func(asset string, price float64, _ time.Time) {
+				got = append(got, tick{asset, price})
+			}}
+			feed.handleFrame(tt.frame)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("message %d: got %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestPriceFeedRun(t *testing.T) {
+	paths := make(chan string, 1)
+	url := fakeBitkub(t, func(ws *websocket.Conn) {
+		paths <- ws.Request().URL.Path
+		websocket.Message.Send(ws, `{"stream":"market.ticker.thb_btc","last":"2100000"}`)
+		websocket.Message.Send(ws, `{"stream":"market.trade.thb_eth","rat":90000}`)
+		var discard string
+		websocket.Message.Receive(ws, &discard)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ticks := make(chan tick, 2)
+	feed := &PriceFeed{
+		URL:       url + "/websocket-api/",
+		Assets:    []string{"BTC", "ETH"},
+		Heartbeat: time.Second,
+		OnPrice:   func(asset string, price float64, _ time.Time) { ticks <- tick{asset, price} },
+	}
+	errc := make(chan error, 1)
+	go func() { errc <- feed.Run(ctx) }()
+
+	want := "/websocket-api/market.ticker.thb_btc,market.trade.thb_btc,market.ticker.thb_eth,market.trade.thb_eth"
+	if got := <-paths; got != want {
+		t.Errorf("stream path = %q, want %q", got, want)
+	}
+	for _, w := range []tick{{"BTC", 2100000}, {"ETH", 90000}} {
+		select {
+		case got := <-ticks:
+			if got != w {
+				t.Errorf("got %v, want %v", got, w)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("no price for %s", w.asset)
+		}
+	}
+
+	cancel()
+	select {
+	case err := <-errc:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Run after cancel = %v, want context.Canceled", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+}
+
+func TestPriceFeedHeartbeat(t *testing.T) {
+	heartbeat := 50 * time.Millisecond
+
+	t.Run("quiet pair answering pings stays connected", func(t *testing.T) {
+		// Reading makes the server answer our pings; it never sends a price.
+		url := fakeBitkub(t, func(ws *websocket.Conn) {
+			var discard string
+			for websocket.Message.Receive(ws, &discard) == nil {
+			}
+		})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		feed := &PriceFeed{URL: url, Assets: []string{"BTC"}, Heartbeat: heartbeat}
+		errc := make(chan error, 1)
+		go func() { errc <- feed.Run(ctx) }()
+
+		select {
+		case err := <-errc:
+			t.Fatalf("Run = %v, want it to stay connected", err)
+		case <-time.After(10 * heartbeat):
+		}
+		cancel()
+		if err := <-errc; !errors.Is(err, context.Canceled) {
+			t.Errorf("Run after cancel = %v, want context.Canceled", err)
+		}
+	})
+
+	t.Run("no pongs is dead", func(t *testing.T) {
+		// Not reading means pings are never answered.
+		release := make(chan struct{})
+		url := fakeBitkub(t, func(ws *websocket.Conn) { <-release })
+		defer close(release)
+
+		feed := &PriceFeed{URL: url, Assets: []string{"BTC"}, Heartbeat: heartbeat}
+		started := time.Now()
+		errc := make(chan error, 1)
+		go func() { errc <- feed.Run(context.Background()) }()
+
+		select {
+		case err := <-errc:
+			var netErr net.Error
+			if !errors.As(err, &netErr) || !netErr.Timeout() {
+				t.Errorf("Run = %v, want a timeout", err)
+			}
+			if elapsed := time.Since(started); elapsed < 3*heartbeat {
+				t.Errorf("timed out after %s, want at least %s", elapsed, 3*heartbeat)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("a connection without pongs was not dropped")
+		}
+	})
+}
+
+func TestRunPriceFeedReconnects(t *testing.T) {
+	oldMin, oldMax := feedBackoffMin, feedBackoffMax
+	feedBackoffMin, feedBackoffMax = 20*time.Millisecond, 80*time.Millisecond
+	t.Cleanup(func() { feedBackoffMin, feedBackoffMax = oldMin, oldMax })
+
+	// The first three connections drop at once; the fourth sends a price.
+	const drops = 3
+	var mu sync.Mutex
+	var connects []time.Time
+	url := fakeBitkub(t, func(ws *websocket.Conn) {
+		mu.Lock()
+		connects = append(connects, time.Now())
+		n := len(connects)
+		mu.Unlock()
+		if n <= drops {
+			return
+		}
+		websocket.Message.Send(ws, `{"stream":"market.ticker.thb_btc","last":2200000}`)
+		var discard string
+		websocket.Message.Receive(ws, &discard)
+	})
+	useFeedConfig(t, url, time.Second, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		runPriceFeed(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if price, ok := streamedPrice("BTC", time.Minute); ok {
+			if price != 2200000 {
+				t.Fatalf("streamed price = %v, want 2200000", price)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("no price after reconnecting")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !CurrentPriceFeedStatus().Connected {
+		t.Error("feed not reported as connected")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(connects) != drops+1 {
+		t.Fatalf("connected %d times, want %d", len(connects), drops+1)
+	}
+	// Each wait is backoff/2 plus jitter, and the backoff doubles up to the max.
+	backoff := feedBackoffMin
+	for i := 1; i < len(connects); i++ {
+		if gap := connects[i].Sub(connects[i-1]); gap < backoff/2 {
+			t.Errorf("reconnect %d after %s, want at least %s", i, gap, backoff/2)
+		}
+		backoff = min(backoff*2, feedBackoffMax)
+	}
+}
+
+func TestMoveTrigger(t *testing.T) {
+	useFeedConfig(t, "", time.Second, 5)
+	setMovePrices(PortfolioSummary{Portfolio: []AssetData{{Asset: "BTC", CurrentPrice: 100}}})
+
+	triggered := func() bool {
+		select {
+		case <-rebalanceTriggers:
+			return true
+		default:
+			return false
+		}
+	}
+
+	now := time.Now()
+	onStreamedPrice("BTC", 104, now)
+	if triggered() {
+		t.Fatal("a 4% move triggered a check")
+	}
+	onStreamedPrice("BTC", 94, now)
+	if !triggered() {
+		t.Fatal("a -6% move did not trigger a check")
+	}
+	// The move is measured from the price that triggered.
+	onStreamedPrice("BTC", 97, now)
+	if triggered() {
+		t.Fatal("a 3% move after a trigger triggered again")
+	}
+	onStreamedPrice("BTC", 99, now)
+	if !triggered() {
+		t.Fatal("a 5.3% move from the last trigger did not trigger a check")
+	}
+	if price, ok := streamedPrice("BTC", time.Minute); !ok || price != 99 {
+		t.Errorf("streamed price = %v, %v; want 99, true", price, ok)
+	}
+}
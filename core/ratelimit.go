@@ -0,0 +1,125 @@
+package core
+
+import (
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// LoginLimiter counts failed logins per key (an IP or a username) inside a
+// sliding window and locks the key out once it reaches the limit.
+type LoginLimiter struct {
+	MaxAttempts int
+	Window      time.Duration
+	Lockout     time.Duration
+
+	mu        sync.Mutex
+	failures  map[string][]time.Time
+	locked    map[string]time.Time
+	lastPrune time.Time
+}
+
+func NewLoginLimiter(maxAttempts int, window time.Duration, lockout time.Duration) *LoginLimiter {
+	return &LoginLimiter{
+		MaxAttempts: maxAttempts,
+		Window:      window,
+		Lockout:     lockout,
+		failures:    map[string][]time.Time{},
+		locked:      map[string]time.Time{},
+	}
+}
+
+// LockedFor returns how much longer the key is locked out, or 0.
+func (l *LoginLimiter) LockedFor(key string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	until, ok := l.locked[key]
+	if !ok {
+		return 0
+	}
+	if remaining := time.Until(until); remaining > 0 {
+		return remaining
+	}
+	delete(l.locked, key)
+	return 0
+}
+
+// Fail records a failed attempt and reports whether it triggered a lockout.
+func (l *LoginLimiter) Fail(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.prune(now)
+
+	recent := []time.Time{}
+	for _, t := range l.failures[key] {
+		if now.Sub(t) < l.Window {
+			recent = append(recent, t)
+		}
+	}
+	recent = append(recent, now)
+
+	if len(recent) >= l.MaxAttempts {
+		l.locked[key] = now.Add(l.Lockout)
+		delete(l.failures, key)
+		return true
+	}
+	l.failures[key] = recent
+	return false
+}
+
+// prune drops keys whose failures are all outside the window and lockouts
+// that have run out, so failed logins with many different usernames or IPs
+// cannot grow the maps without bound. It sweeps at most once per window.
+func (l *LoginLimiter) prune(now time.Time) {
+	if now.Sub(l.lastPrune) < l.Window {
+		return
+	}
+	l.lastPrune = now
+
+	for key, times := range l.failures {
+		if len(times) == 0 || now.Sub(times[len(times)-1]) >= l.Window {
+			delete(l.failures, key)
+		}
+	}
+	for key, until := range l.locked {
+		if !now.Before(until) {
+			delete(l.locked, key)
+		}
+	}
+}
+
+func (l *LoginLimiter) Reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.failures, key)
+	delete(l.locked, key)
+}
+
+// Login throttles, configured by LOGIN_MAX_ATTEMPTS_USER,
+// LOGIN_MAX_ATTEMPTS_IP and LOGIN_LOCKOUT_MINUTES.
+var (
+	UserLoginLimiter *LoginLimiter
+	IPLoginLimiter   *LoginLimiter
+)
+
+func InitLoginLimiters() {
+	lockout := 15 * time.Minute
+	if val, err := strconv.Atoi(os.Getenv("LOGIN_LOCKOUT_MINUTES")); err == nil && val > 0 {
+		lockout = time.Duration(val) * time.Minute
+	}
+
+	perUser, perIP := 5, 20
+	if val, err := strconv.Atoi(os.Getenv("LOGIN_MAX_ATTEMPTS_USER")); err == nil && val > 0 {
+		perUser = val
+	}
+	if val, err := strconv.Atoi(os.Getenv("LOGIN_MAX_ATTEMPTS_IP")); err == nil && val > 0 {
+		perIP = val
+	}
+
+	UserLoginLimiter = NewLoginLimiter(perUser, lockout, lockout)
+	IPLoginLimiter = NewLoginLimiter(perIP, lockout, lockout)
+}
@@ -0,0 +1,69 @@
+package core
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestLoginLimiter(t *testing.T) {
+	l := NewLoginLimiter(3, time.Hour, time.Hour)
+
+	for i := 1; i < 3; i++ {
+		if l.Fail("alice") {
+			t.Fatalf("locked out after %d failures, want 3", i)
+		}
+	}
+	if l.LockedFor("alice") != 0 {
+		t.Fatal("locked out before the limit")
+	}
+	if !l.Fail("alice") {
+		t.Fatal("third failure did not lock out")
+	}
+	if d := l.LockedFor("alice"); d <= 0 || d > time.Hour {
+		t.Errorf("LockedFor = %s, want up to an hour", d)
+	}
+	if l.LockedFor("bob") != 0 {
+		t.Error("another key is locked out")
+	}
+
+	l.Reset("alice")
+	if l.LockedFor("alice") != 0 || l.Fail("alice") {
+		t.Error("Reset did not clear the lockout and the failures")
+	}
+}
+
+func TestLoginLimiterWindow(t *testing.T) {
+	l := NewLoginLimiter(2, 30*time.Millisecond, 30*time.Millisecond)
+
+	l.Fail("alice")
+	time.Sleep(40 * time.Millisecond)
+	if l.Fail("alice") {
+		t.Fatal("a failure outside the window still counted")
+	}
+	if !l.Fail("alice") {
+		t.Fatal("two failures inside the window did not lock out")
+	}
+	time.Sleep(40 * time.Millisecond)
+	if l.LockedFor("alice") != 0 {
+		t.Error("lockout did not expire")
+	}
+}
+
+func TestLoginLimiterPrunes(t *testing.T) {
+	l := NewLoginLimiter(2, 30*time.Millisecond, 30*time.Millisecond)
+	for i := 0; i < 1000; i++ {
+		l.Fail(fmt.Sprintf("user%d", i))
+	}
+	l.Fail("mallory")
+	l.Fail("mallory")
+
+	time.Sleep(40 * time.Millisecond)
+	l.Fail("alice")
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.failures) != 1 || len(l.locked) != 0 {
+		t.Errorf("after the window: %d keys with failures and %d locked, want 1 and 0", len(l.failures), len(l.locked))
+	}
+}
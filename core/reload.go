@@ -0,0 +1,294 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// CurrentConfig returns the config currently in effect.
+func CurrentConfig() Config {
+	ConfigMutex.RLock()
+	defer ConfigMutex.RUnlock()
+
+	targets := make(map[string]float64, len(TargetAssets))
+	for asset, pct := range TargetAssets {
+		targets[asset] = pct
+	}
+	return Config{
+		APIKey:              APIKey,
+		APISecret:           APISecret,
+		APIUrl:              APIUrl,
+		APITimeout:          APITimeout,
+		APIMaxRetries:       APIMaxRetries,
+		APIMaxConcurrent:    APIMaxConcurrent,
+		DiscordWebhookURL:   DiscordWebhookURL,
+		DryRun:              IsDryRun,
+		InitialInvestment:   InitialInvestment,
+		Targets:             targets,
+		Threshold:           Threshold,
+		RebalanceInterval:   RebalanceInterval,
+		MinOrderTHB:         MinOrderTHB,
+		ScheduleCron:        RebalanceSchedule.Cron,
+		ScheduleTimezone:    scheduleTimezone(RebalanceSchedule),
+		ScheduleBlackouts:   blackoutStrings(RebalanceSchedule),
+		StrategyType:        StrategyType,
+		StrategyPeriod:      StrategyPeriod,
+		StrategyBandPct:     StrategyBandPct,
+		RebalanceSizing:     RebalanceSizing,
+		RebalanceFraction:   RebalanceFraction,
+		DCAMode:             DCAMode,
+		DCAPeriod:           DCAPeriod,
+		DCAAmountTHB:        DCAAmountTHB,
+		DCAPeriods:          DCAPeriods,
+		OrderType:           OrderType,
+		LimitOffsetPct:      LimitOffsetPct,
+		LimitTimeout:        LimitTimeout,
+		LimitPollInterval:   LimitPollInterval,
+		LimitMaxReprices:    LimitMaxReprices,
+		LimitMaxSlippagePct: LimitMaxSlippagePct,
+		PaperFeePct:         PaperFeePct,
+		PaperSlippagePct:    PaperSlippagePct,
+		MaxOrderTHB:         MaxOrderTHB,
+		MaxTradesPerRun:     MaxTradesPerRun,
+		MarketCacheTTL:      MarketCacheTTL,
+		MarketWSEnabled:     MarketWSEnabled,
+		MarketWSURL:         MarketWSURL,
+		MarketWSHeartbeat:   MarketWSHeartbeat,
+		MoveTriggerPct:      MoveTriggerPct,
+	}
+}
+
+func (c Config) runtimeSettings() RuntimeSettings {
+	return RuntimeSettings{
+		DryRun:          c.DryRun,
+		Targets:         c.Targets,
+		Threshold:       c.Threshold,
+		IntervalSeconds: int(c.RebalanceInterval / time.Second),
+		MinOrderTHB:     c.MinOrderTHB,
+	}
+}
+
+func (c *Config) setRuntimeSettings(s RuntimeSettings) {
+	c.DryRun = s.DryRun
+	c.Targets = s.Targets
+	c.Threshold = s.Threshold
+	c.RebalanceInterval = time.Duration(s.IntervalSeconds) * time.Second
+	c.MinOrderTHB = s.MinOrderTHB
+}
+
+func scheduleTimezone(s *Schedule) string {
+	if s.Location == nil || s.Location == time.Local {
+		return ""
+	}
+	return s.Location.String()
+}
+
+func blackoutStrings(s *Schedule) []string {
+	windows := []string{}
+	for _, b := range s.Blackouts {
+		windows = append(windows, b.Raw)
+	}
+	return windows
+}
+
+// DiffConfig lists what changed between two configs. Secrets are never
+// printed, only that they changed.
+func DiffConfig(old Config, updated Config) []string {
+	changes := DiffSettings(old.runtimeSettings(), updated.runtimeSettings())
+
+	if old.APIKey != updated.APIKey || old.APISecret != updated.APISecret {
+		changes = append(changes, "bitkub api key/secret changed")
+	}
+	if old.APIUrl != updated.APIUrl {
+		changes = append(changes, fmt.Sprintf("bitkub base url: %s → %s", old.APIUrl, updated.APIUrl))
+	}
+	if old.APITimeout != updated.APITimeout || old.APIMaxRetries != updated.APIMaxRetries ||
+		old.APIMaxConcurrent != updated.APIMaxConcurrent {
+		changes = append(changes, fmt.Sprintf("bitkub client: timeout %s, %d retries, %d concurrent → timeout %s, %d retries, %d concurrent",
+			old.APITimeout, old.APIMaxRetries, old.APIMaxConcurrent, updated.APITimeout, updated.APIMaxRetries, updated.APIMaxConcurrent))
+	}
+	if old.DiscordWebhookURL != updated.DiscordWebhookURL {
+		changes = append(changes, "discord webhook url changed")
+	}
+	if old.InitialInvestment != updated.InitialInvestment {
+		changes = append(changes, fmt.Sprintf("initial investment: %.2f → %.2f THB", old.InitialInvestment, updated.InitialInvestment))
+	}
+	if old.ScheduleCron != updated.ScheduleCron {
+		changes = append(changes, fmt.Sprintf("cron: %q → %q", old.ScheduleCron, updated.ScheduleCron))
+	}
+	if old.ScheduleTimezone != updated.ScheduleTimezone {
+		changes = append(changes, fmt.Sprintf("timezone: %q → %q", old.ScheduleTimezone, updated.ScheduleTimezone))
+	}
+	if strings.Join(old.ScheduleBlackouts, ";") != strings.Join(updated.ScheduleBlackouts, ";") {
+		changes = append(changes, fmt.Sprintf("blackouts: %q → %q", strings.Join(old.ScheduleBlackouts, "; "), strings.Join(updated.ScheduleBlackouts, "; ")))
+	}
+	if old.StrategyType != updated.StrategyType || old.StrategyPeriod != updated.StrategyPeriod || old.StrategyBandPct != updated.StrategyBandPct {
+		changes = append(changes, fmt.Sprintf("strategy: %s/%s/%.2f%% → %s/%s/%.2f%%",
+			old.StrategyType, old.StrategyPeriod, old.StrategyBandPct, updated.StrategyType, updated.StrategyPeriod, updated.StrategyBandPct))
+	}
+	if old.RebalanceSizing != updated.RebalanceSizing || old.RebalanceFraction != updated.RebalanceFraction {
+		changes = append(changes, fmt.Sprintf("rebalance sizing: %s/%.2f → %s/%.2f",
+			old.RebalanceSizing, old.RebalanceFraction, updated.RebalanceSizing, updated.RebalanceFraction))
+	}
+	if old.DCAMode != updated.DCAMode || old.DCAPeriod != updated.DCAPeriod ||
+		old.DCAAmountTHB != updated.DCAAmountTHB || old.DCAPeriods != updated.DCAPeriods {
+		changes = append(changes, fmt.Sprintf("DCA: %s/%s/%.2f THB/%d periods → %s/%s/%.2f THB/%d periods",
+			old.DCAMode, old.DCAPeriod, old.DCAAmountTHB, old.DCAPeriods,
+			updated.DCAMode, updated.DCAPeriod, updated.DCAAmountTHB, updated.DCAPeriods))
+	}
+	if old.OrderType != updated.OrderType {
+		changes = append(changes, fmt.Sprintf("order type: %s → %s", old.OrderType, updated.OrderType))
+	}
+	if old.LimitOffsetPct != updated.LimitOffsetPct {
+		changes = append(changes, fmt.Sprintf("limit offset: %.2f%% → %.2f%%", old.LimitOffsetPct, updated.LimitOffsetPct))
+	}
+	if old.LimitTimeout != updated.LimitTimeout {
+		changes = append(changes, fmt.Sprintf("limit timeout: %s → %s", old.LimitTimeout, updated.LimitTimeout))
+	}
+	if old.LimitPollInterval != updated.LimitPollInterval {
+		changes = append(changes, fmt.Sprintf("limit poll: %s → %s", old.LimitPollInterval, updated.LimitPollInterval))
+	}
+	if old.LimitMaxReprices != updated.LimitMaxReprices {
+		changes = append(changes, fmt.Sprintf("limit max reprices: %d → %d", old.LimitMaxReprices, updated.LimitMaxReprices))
+	}
+	if old.LimitMaxSlippagePct != updated.LimitMaxSlippagePct {
+		changes = append(changes, fmt.Sprintf("limit max slippage: %.2f%% → %.2f%%", old.LimitMaxSlippagePct, updated.LimitMaxSlippagePct))
+	}
+	if old.PaperFeePct != updated.PaperFeePct || old.PaperSlippagePct != updated.PaperSlippagePct {
+		changes = append(changes, fmt.Sprintf("paper fee/slippage: %.2f%%/%.2f%% → %.2f%%/%.2f%%",
+			old.PaperFeePct, old.PaperSlippagePct, updated.PaperFeePct, updated.PaperSlippagePct))
+	}
+	if old.MaxOrderTHB != updated.MaxOrderTHB {
+		changes = append(changes, fmt.Sprintf("max order: %.2f → %.2f THB", old.MaxOrderTHB, updated.MaxOrderTHB))
+	}
+	if old.MaxTradesPerRun != updated.MaxTradesPerRun {
+		changes = append(changes, fmt.Sprintf("max trades per run: %d → %d", old.MaxTradesPerRun, updated.MaxTradesPerRun))
+	}
+	if old.MarketCacheTTL != updated.MarketCacheTTL {
+		changes = append(changes, fmt.Sprintf("market cache TTL: %s → %s", old.MarketCacheTTL, updated.MarketCacheTTL))
+	}
+	if old.MarketWSEnabled != updated.MarketWSEnabled || old.MarketWSURL != updated.MarketWSURL ||
+		old.MarketWSHeartbeat != updated.MarketWSHeartbeat {
+		changes = append(changes, fmt.Sprintf("price feed: %v %s (heartbeat %s) → %v %s (heartbeat %s)",
+			old.MarketWSEnabled, old.MarketWSURL, old.MarketWSHeartbeat, updated.MarketWSEnabled, updated.MarketWSURL, updated.MarketWSHeartbeat))
+	}
+	if old.MoveTriggerPct != updated.MoveTriggerPct {
+		changes = append(changes, fmt.Sprintf("move trigger: %.2f%% → %.2f%%", old.MoveTriggerPct, updated.MoveTriggerPct))
+	}
+	return changes
+}
+
+// ReloadConfig re-reads the config file and env vars and applies the result
+// in one step under ConfigMutex, so the bot loop never sees half a config.
+// An invalid config is rejected and the current one stays in effect.
+//
+// Runtime settings follow the same rule as startup: only values that changed
+// in the file/env since they were last loaded override dashboard changes.
+// The exchange clients are built once at startup, so changes to the Bitkub
+// credentials or the paper fee/slippage are reported but need a restart.
+func ReloadConfig(path string, trigger string) error {
+	settingsWriteMutex.Lock()
+	defer settingsWriteMutex.Unlock()
+
+	cfg, err := BuildConfig(path)
+	if err != nil {
+		fmt.Printf("❌ Config reload (%s) rejected, keeping the current config\n%v\n", trigger, err)
+		Audit(AuditConfigReload, "system", "", "", fmt.Sprintf("%s: rejected: %v", trigger, err))
+		go SendDiscordConfigReload(trigger, nil, err)
+		publishError("Config reload (%s) rejected: %v", trigger, err)
+		return err
+	}
+
+	old := CurrentConfig()
+	bootstrap := cfg.runtimeSettings()
+
+	previous, err := lastBootstrap(bootstrap)
+	if err != nil {
+		fmt.Printf("❌ Config reload (%s) failed: %v\n", trigger, err)
+		return err
+	}
+	effective := mergeBootstrap(old.runtimeSettings(), previous, bootstrap)
+	cfg.setRuntimeSettings(effective)
+
+	restart := []string{}
+	if cfg.APIKey != old.APIKey || cfg.APISecret != old.APISecret || cfg.APIUrl != old.APIUrl {
+		restart = append(restart, "bitkub credentials/base url")
+		cfg.APIKey, cfg.APISecret, cfg.APIUrl = old.APIKey, old.APISecret, old.APIUrl
+	}
+	if cfg.PaperFeePct != old.PaperFeePct || cfg.PaperSlippagePct != old.PaperSlippagePct {
+		restart = append(restart, "paper fee/slippage")
+		cfg.PaperFeePct, cfg.PaperSlippagePct = old.PaperFeePct, old.PaperSlippagePct
+	}
+	if len(restart) > 0 {
+		fmt.Printf("⚠️ Config reload (%s): %s changed but only take effect after a restart\n", trigger, strings.Join(restart, ", "))
+	}
+
+	// The saved settings merged in were never validated with this config.
+	if errs := cfg.Validate(); len(errs) > 0 {
+		err := ConfigErrors(errs)
+		fmt.Printf("❌ Config reload (%s) rejected, keeping the current config\n%v\n", trigger, err)
+		Audit(AuditConfigReload, "system", "", "", fmt.Sprintf("%s: rejected: %v", trigger, err))
+		go SendDiscordConfigReload(trigger, nil, err)
+		publishError("Config reload (%s) rejected: %v", trigger, err)
+		return err
+	}
+
+	if previous == nil || len(DiffSettings(*previous, bootstrap)) > 0 {
+		changes := DiffSettings(old.runtimeSettings(), effective)
+		if err := saveSettingsVersion(effective, "reload ("+trigger+")", SourceReload, changes, &bootstrap); err != nil {
+			fmt.Printf("❌ Config reload (%s) failed: %v\n", trigger, err)
+			return err
+		}
+	}
+
+	changes := DiffConfig(old, cfg)
+	if len(changes) == 0 {
+		fmt.Printf("♻️ Config reload (%s): nothing changed\n", trigger)
+		return nil
+	}
+
+	cfg.apply()
+	if old.DryRun != cfg.DryRun {
+		PublishEvent(EventMode, ModeEvent{Mode: modeName(cfg.DryRun), Actor: "reload (" + trigger + ")"})
+	}
+	notifyPortfolioChanged()
+
+	fmt.Printf("♻️ Config reloaded (%s):\n", trigger)
+	for _, change := range changes {
+		fmt.Printf("   • %s\n", change)
+	}
+	Audit(AuditConfigReload, "system", "", "", trigger+": "+strings.Join(changes, "; "))
+	go SendDiscordConfigReload(trigger, changes, nil)
+	return nil
+}
+
+// WatchConfigFile polls the config file and reloads when its modification
+// time or size changes. The file is looked up by path on every poll, so
+// editors that save by replacing the file are picked up too.
+func WatchConfigFile(path string, every time.Duration) {
+	stamp := func() string {
+		info, err := os.Stat(path)
+		if err != nil {
+			return ""
+		}
+		return fmt.Sprintf("%d/%d", info.ModTime().UnixNano(), info.Size())
+	}
+
+	last := stamp()
+	for {
+		time.Sleep(every)
+
+		current := stamp()
+		if current == last {
+			continue
+		}
+		last = current
+		if current == "" {
+			fmt.Printf("⚠️ Config file %s disappeared, keeping the current config\n", path)
+			continue
+		}
+		ReloadConfig(path, "file change")
+	}
+}
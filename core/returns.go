@@ -0,0 +1,173 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// Returns is portfolio performance that deposits and withdrawals do not
+// distort. ROI is the gain over net invested cash; TWR chains the return of
+// every period between snapshots (cumulative, since the first snapshot) and
+// MWR is the annualised internal rate of return of the cash flows (XIRR).
+// TWR and MWR are nil until there is enough history to compute them.
+type Returns struct {
+	NetInvested float64  `json:"net_invested"`
+	ROI         float64  `json:"roi"`
+	TWR         *float64 `json:"twr"`
+	MWR         *float64 `json:"mwr"`
+}
+
+// CalculateReturns measures a mode's performance at its current value.
+func CalculateReturns(mode string, value float64) Returns {
+	r := Returns{NetInvested: NetInvested(mode)}
+	if r.NetInvested > 0 {
+		r.ROI = (value - r.NetInvested) / r.NetInvested * 100.0
+	}
+
+	flows, err := ListCashFlows(mode, 0)
+	if err != nil {
+		fmt.Printf("⚠️ Failed to load cash flows: %v\n", err)
+		return r
+	}
+	now := time.Now()
+	if twr, ok := timeWeightedReturn(mode, flows, value, now); ok {
+		r.TWR = &twr
+	}
+	if mwr, ok := moneyWeightedReturn(flows, value, now); ok {
+		r.MWR = &mwr
+	}
+	return r
+}
+
+// twrProgress is the time-weighted return chained up to the last snapshot
+// read, so each call only has to read the snapshots taken since.
+type twrProgress struct {
+	lastID    int64
+	lastAt    time.Time
+	lastValue float64
+	index     float64
+}
+
+var (
+	twrCache = map[string]*twrProgress{}
+	twrMutex sync.Mutex
+)
+
+// invalidateReturns makes the next call start over when a cash flow is
+// entered for (or removed from) a period that has already been chained.
+func invalidateReturns(mode string, at time.Time) {
+	twrMutex.Lock()
+	defer twrMutex.Unlock()
+	if p, ok := twrCache[mode]; ok && !at.After(p.lastAt) {
+		delete(twrCache, mode)
+	}
+}
+
+func timeWeightedReturn(mode string, flows []CashFlow, value float64, now time.Time) (float64, bool) {
+	twrMutex.Lock()
+	defer twrMutex.Unlock()
+
+	p, ok := twrCache[mode]
+	if !ok {
+		p = &twrProgress{index: 1}
+		twrCache[mode] = p
+	}
+
+	rows, err := DB.Query(`SELECT id, timestamp, total_value FROM snapshots WHERE mode = ? AND id > ? ORDER BY id`, mode, p.lastID)
+	if err != nil {
+		fmt.Printf("⚠️ Failed to load snapshots: %v\n", err)
+		return 0, false
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var at time.Time
+		var v float64
+		if err := rows.Scan(&id, &at, &v); err != nil {
+			fmt.Printf("⚠️ Failed to read snapshot: %v\n", err)
+			return 0, false
+		}
+		p.link(flows, at, v)
+		p.lastID = id
+	}
+	if p.lastID == 0 {
+		return 0, false
+	}
+
+	// Chain the live value on top without storing it.
+	current := *p
+	current.link(flows, now, value)
+	return (current.index - 1) * 100.0, true
+}
+
+// link chains the period from the previous snapshot to (at, value). Cash
+// that came in during the period is taken out of the closing value, so only
+// the market move counts.
+func (p *twrProgress) link(flows []CashFlow, at time.Time, value float64) {
+	net := 0.0
+	for _, f := range flows {
+		if f.Timestamp.After(p.lastAt) && !f.Timestamp.After(at) {
+			net += f.Signed()
+		}
+	}
+	if p.lastValue > 0 && !p.lastAt.IsZero() {
+		p.index *= (value - net) / p.lastValue
+	}
+	p.lastAt = at
+	p.lastValue = value
+}
+
+// resetReturns forgets a mode's chained return, e.g. after the paper wallet is reset.
+func resetReturns(mode string) {
+	twrMutex.Lock()
+	delete(twrCache, mode)
+	twrMutex.Unlock()
+}
+
+// moneyWeightedReturn solves for the annual rate at which the deposits and
+// withdrawals would have grown into value (XIRR). It needs at least a day
+// of history.
+func moneyWeightedReturn(flows []CashFlow, value float64, now time.Time) (float64, bool) {
+	if len(flows) == 0 {
+		return 0, false
+	}
+	start := now
+	for _, f := range flows {
+		if f.Timestamp.Before(start) {
+			start = f.Timestamp
+		}
+	}
+	if now.Sub(start) < 24*time.Hour {
+		return 0, false
+	}
+
+	years := func(t time.Time) float64 { return t.Sub(start).Hours() / 24 / 365.25 }
+	npv := func(rate float64) float64 {
+		total := value / math.Pow(1+rate, years(now))
+		for _, f := range flows {
+			// From the investor's side a deposit is money paid in.
+			total -= f.Signed() / math.Pow(1+rate, years(f.Timestamp))
+		}
+		return total
+	}
+
+	lo, hi := -0.9999, 1.0
+	for npv(hi) > 0 && hi < 1e6 {
+		hi *= 2
+	}
+	if npv(lo)*npv(hi) > 0 {
+		return 0, false
+	}
+	for i := 0; i < 200; i++ {
+		mid := (lo + hi) / 2
+		if npv(lo)*npv(mid) <= 0 {
+			hi = mid
+		} else {
+			lo = mid
+		}
+	}
+	return (lo + hi) / 2 * 100.0, true
+}
@@ -0,0 +1,383 @@
+package core
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	_ "time/tzdata" // the slim Docker image has no zoneinfo
+)
+
+// Schedule decides when the bot loop runs a rebalance check: every
+// RebalanceInterval, or at the times of a cron expression, but never inside
+// a blackout window. Times are evaluated in Location.
+type Schedule struct {
+	Cron      string
+	Location  *time.Location
+	Blackouts []Blackout
+
+	cron *cronExpr
+}
+
+// NewSchedule parses a cron expression (empty = use the interval), a time
+// zone name (empty = local time) and blackout windows such as
+// "Wed 02:00-04:00" or "Mon-Fri 23:30-00:30".
+func NewSchedule(cron string, timezone string, blackouts []string) (*Schedule, error) {
+	s := &Schedule{Cron: strings.TrimSpace(cron), Location: time.Local}
+
+	if timezone != "" {
+		loc, err := time.LoadLocation(timezone)
+		if err != nil {
+			return nil, fmt.Errorf("unknown time zone %q", timezone)
+		}
+		s.Location = loc
+	}
+
+	if s.Cron != "" {
+		expr, err := parseCron(s.Cron)
+		if err != nil {
+			return nil, fmt.Errorf("cron %q: %w", s.Cron, err)
+		}
+		if expr.next(time.Now().In(s.Location)).IsZero() {
+			return nil, fmt.Errorf("cron %q never matches a date", s.Cron)
+		}
+		s.cron = expr
+	}
+
+	for _, raw := range blackouts {
+		if strings.TrimSpace(raw) == "" {
+			continue
+		}
+		b, err := ParseBlackout(raw)
+		if err != nil {
+			return nil, err
+		}
+		s.Blackouts = append(s.Blackouts, b)
+	}
+	return s, nil
+}
+
+// Next returns when the next check should start. last is the slot of the
+// previous check (zero before the first one) and started is when the loop
+// started. Interval slots are counted from the previous slot rather than
+// from when the check finished, so the schedule does not drift. A check
+// that overran its slot starts the next one straight away; missed cron
+// slots are skipped rather than caught up.
+func (s *Schedule) Next(interval time.Duration, last time.Time, started time.Time, now time.Time) time.Time {
+	var next time.Time
+	if s.cron != nil {
+		from := last
+		if from.IsZero() {
+			from = started
+		}
+		next = s.cron.next(from.In(s.Location))
+		if next.Before(now.Add(-time.Minute)) {
+			next = s.cron.next(now.In(s.Location))
+		}
+	} else {
+		next = started
+		if !last.IsZero() {
+			next = last.Add(interval)
+		}
+		if next.Before(now) {
+			next = now
+		}
+	}
+
+	// Windows can be back to back, so keep moving until we land outside all of them.
+	for i := 0; i < 100 && !next.IsZero(); i++ {
+		end, blocked := s.blackoutEnd(next)
+		if !blocked {
+			break
+		}
+		if s.cron != nil {
+			next = s.cron.next(end.Add(-time.Second))
+		} else {
+			next = end
+		}
+	}
+	return next
+}
+
+// InBlackout reports whether t falls inside a blackout window.
+func (s *Schedule) InBlackout(t time.Time) bool {
+	_, blocked := s.blackoutEnd(t)
+	return blocked
+}
+
+func (s *Schedule) blackoutEnd(t time.Time) (time.Time, bool) {
+	local := t.In(s.Location)
+	for _, b := range s.Blackouts {
+		if end, ok := b.endIfInside(local); ok {
+			return end, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// Describe summarises the schedule for logs and the dashboard.
+func (s *Schedule) Describe(interval time.Duration) string {
+	desc := fmt.Sprintf("every %s", interval)
+	if s.cron != nil {
+		desc = fmt.Sprintf("cron %q (%s)", s.Cron, s.Location)
+	}
+	if len(s.Blackouts) > 0 {
+		windows := make([]string, len(s.Blackouts))
+		for i, b := range s.Blackouts {
+			windows[i] = b.Raw
+		}
+		desc += ", paused " + strings.Join(windows, "; ")
+	}
+	return desc
+}
+
+// Blackout is a daily or weekly window in which no check starts. A window
+// whose end is before its start runs past midnight into the next day.
+type Blackout struct {
+	Raw   string
+	Days  [7]bool
+	Start int // minutes after midnight
+	End   int
+}
+
+var weekdayNames = map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}
+
+// ParseBlackout reads "[DAYS ]HH:MM-HH:MM" where DAYS is "Wed", "Mon-Fri"
+// or "Sat,Sun". Without DAYS the window applies every day.
+func ParseBlackout(raw string) (Blackout, error) {
+	b := Blackout{Raw: strings.TrimSpace(raw)}
+	fields := strings.Fields(b.Raw)
+	if len(fields) == 0 || len(fields) > 2 {
+		return b, fmt.Errorf("blackout %q: expected [DAYS ]HH:MM-HH:MM", raw)
+	}
+
+	window := fields[len(fields)-1]
+	if len(fields) == 1 {
+		for i := range b.Days {
+			b.Days[i] = true
+		}
+	} else {
+		for _, part := range strings.Split(strings.ToLower(fields[0]), ",") {
+			from, to, isRange := strings.Cut(part, "-")
+			start, ok := weekdayNames[from]
+			if !ok {
+				return b, fmt.Errorf("blackout %q: unknown day %q", raw, from)
+			}
+			end := start
+			if isRange {
+				if end, ok = weekdayNames[to]; !ok {
+					return b, fmt.Errorf("blackout %q: unknown day %q", raw, to)
+				}
+			}
+			for d := start; ; d = (d + 1) % 7 {
+				b.Days[d] = true
+				if d == end {
+					break
+				}
+			}
+		}
+	}
+
+	from, to, ok := strings.Cut(window, "-")
+	if !ok {
+		return b, fmt.Errorf("blackout %q: expected HH:MM-HH:MM", raw)
+	}
+	var err error
+	if b.Start, err = parseClock(from); err != nil {
+		return b, fmt.Errorf("blackout %q: %w", raw, err)
+	}
+	if b.End, err = parseClock(to); err != nil {
+		return b, fmt.Errorf("blackout %q: %w", raw, err)
+	}
+	if b.Start == b.End {
+		return b, fmt.Errorf("blackout %q: start and end are the same", raw)
+	}
+	return b, nil
+}
+
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// endIfInside returns when the window containing t ends.
+func (b Blackout) endIfInside(t time.Time) (time.Time, bool) {
+	minute := t.Hour()*60 + t.Minute()
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	weekday := int(t.Weekday())
+	overnight := b.End < b.Start
+
+	if b.Days[weekday] && minute >= b.Start && (overnight || minute < b.End) {
+		if overnight {
+			return midnight.AddDate(0, 0, 1).Add(time.Duration(b.End) * time.Minute), true
+		}
+		return midnight.Add(time.Duration(b.End) * time.Minute), true
+	}
+	// The tail of an overnight window that started yesterday.
+	if overnight && b.Days[(weekday+6)%7] && minute < b.End {
+		return midnight.Add(time.Duration(b.End) * time.Minute), true
+	}
+	return time.Time{}, false
+}
+
+// cronExpr is a standard 5-field cron expression: minute hour day-of-month
+// month day-of-week. Fields take *, lists, ranges and steps; months and
+// weekdays also take names (jan, mon).
+type cronExpr struct {
+	minute, hour, dom, month, dow uint64
+	domAll, dowAll                bool
+}
+
+var monthNames = map[string]int{"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12}
+
+func parseCron(expr string) (*cronExpr, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("expected 5 fields (minute hour day month weekday), got %d", len(fields))
+	}
+
+	c := &cronExpr{}
+	var err error
+	if c.minute, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, fmt.Errorf("minute: %w", err)
+	}
+	if c.hour, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return nil, fmt.Errorf("hour: %w", err)
+	}
+	if c.dom, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return nil, fmt.Errorf("day of month: %w", err)
+	}
+	if c.month, err = parseCronField(fields[3], 1, 12, monthNames); err != nil {
+		return nil, fmt.Errorf("month: %w", err)
+	}
+	if c.dow, err = parseCronField(fields[4], 0, 7, weekdayNames); err != nil {
+		return nil, fmt.Errorf("day of week: %w", err)
+	}
+	// 7 is Sunday as well.
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	c.domAll = fields[2] == "*"
+	c.dowAll = fields[4] == "*"
+	return c, nil
+}
+
+func parseCronField(field string, min int, max int, names map[string]int) (uint64, error) {
+	value := func(s string) (int, error) {
+		if n, ok := names[strings.ToLower(s)]; ok {
+			return n, nil
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < min || n > max {
+			return 0, fmt.Errorf("%q is not between %d and %d", s, min, max)
+		}
+		return n, nil
+	}
+
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepPart)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step %q", stepPart)
+			}
+			step = n
+		}
+
+		start, end := min, max
+		if rangePart != "*" {
+			from, to, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if start, err = value(from); err != nil {
+				return 0, err
+			}
+			end = start
+			if isRange {
+				if end, err = value(to); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				end = max
+			}
+			if end < start {
+				return 0, fmt.Errorf("range %q goes backwards", rangePart)
+			}
+		}
+
+		for n := start; n <= end; n += step {
+			bits |= 1 << uint(n)
+		}
+	}
+	return bits, nil
+}
+
+func (c *cronExpr) dayMatches(t time.Time) bool {
+	domMatch := c.dom&(1<<uint(t.Day())) != 0
+	dowMatch := c.dow&(1<<uint(t.Weekday())) != 0
+	// As in cron, when both fields are restricted either one may match.
+	if !c.domAll && !c.dowAll {
+		return domMatch || dowMatch
+	}
+	return domMatch && dowMatch
+}
+
+// next returns the first matching minute strictly after t, or the zero
+// time if there is none within five years.
+func (c *cronExpr) next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if c.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if c.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+		if c.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// ScheduleSummary describes the schedule currently in effect.
+func ScheduleSummary() string {
+	ConfigMutex.RLock()
+	defer ConfigMutex.RUnlock()
+	return RebalanceSchedule.Describe(RebalanceInterval)
+}
+
+var (
+	nextRun      time.Time
+	nextRunMutex sync.RWMutex
+)
+
+// NextRun returns when the bot loop plans to run the next check.
+func NextRun() time.Time {
+	nextRunMutex.RLock()
+	defer nextRunMutex.RUnlock()
+	return nextRun
+}
+
+func setNextRun(t time.Time) {
+	nextRunMutex.Lock()
+	nextRun = t
+	nextRunMutex.Unlock()
+}
@@ -0,0 +1,153 @@
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+// at is a time on the week of Wednesday 14 October 2026, in UTC.
+func at(day int, hour int, minute int) time.Time {
+	return time.Date(2026, time.October, day, hour, minute, 0, 0, time.UTC)
+}
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{"0 9,21 * * *", at(14, 10, 30), at(14, 21, 0)},
+		{"0 9,21 * * *", at(14, 21, 0), at(15, 9, 0)},
+		{"*/15 * * * *", at(14, 10, 30), at(14, 10, 45)},
+		{"*/15 * * * *", at(14, 10, 31), at(14, 10, 45)},
+		{"30 2 1 * *", at(14, 10, 30), time.Date(2026, time.November, 1, 2, 30, 0, 0, time.UTC)},
+		{"0 9 * * mon-fri", at(16, 10, 0), at(19, 9, 0)},
+		// Day of month and day of week both restricted: either matches.
+		{"0 9 13 * fri", at(14, 10, 30), at(16, 9, 0)},
+		{"0 0 * * 7", at(14, 10, 30), at(18, 0, 0)},
+		{"0 0 * * sun", at(14, 10, 30), at(18, 0, 0)},
+		{"0 12 * dec *", at(14, 10, 30), time.Date(2026, time.December, 1, 12, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", at(14, 10, 30), time.Date(2028, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 2 *", at(14, 10, 30), time.Time{}},
+	}
+	for _, tt := range tests {
+		c, err := parseCron(tt.expr)
+		if err != nil {
+			t.Errorf("parseCron(%q): %v", tt.expr, err)
+			continue
+		}
+		if got := c.next(tt.from); !got.Equal(tt.want) {
+			t.Errorf("%q after %s = %s, want %s", tt.expr, tt.from, got, tt.want)
+		}
+	}
+}
+
+func TestParseCronErrors(t *testing.T) {
+	for _, expr := range []string{
+		"0 9 * *",
+		"0 9 * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"0 9 * * funday",
+		"a * * * *",
+	} {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("parseCron(%q) accepted an invalid expression", expr)
+		}
+	}
+	if _, err := NewSchedule("0 0 31 2 *", "UTC", nil); err == nil {
+		t.Error("NewSchedule accepted a cron that never matches")
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	schedule := func(cron string, blackouts ...string) *Schedule {
+		s, err := NewSchedule(cron, "UTC", blackouts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	tests := []struct {
+		name               string
+		schedule           *Schedule
+		last, started, now time.Time
+		want               time.Time
+	}{
+		{"first interval check runs at start", schedule(""), time.Time{}, at(14, 10, 0), at(14, 10, 0), at(14, 10, 0)},
+		{"interval counts from the last slot", schedule(""), at(14, 10, 0), at(14, 9, 0), at(14, 10, 0).Add(30 * time.Second), at(14, 10, 1)},
+		{"overrun interval starts at once", schedule(""), at(14, 10, 0), at(14, 9, 0), at(14, 10, 5), at(14, 10, 5)},
+		{"cron from start", schedule("0 * * * *"), time.Time{}, at(14, 10, 30), at(14, 10, 30), at(14, 11, 0)},
+		{"missed cron slots are skipped", schedule("0 * * * *"), at(14, 10, 0), at(14, 9, 0), at(14, 13, 30), at(14, 14, 0)},
+		{"interval moved past a blackout", schedule("", "Wed 10:00-12:00"), time.Time{}, at(14, 10, 30), at(14, 10, 30), at(14, 12, 0)},
+		{"blackout on another day", schedule("", "Thu 10:00-12:00"), time.Time{}, at(14, 10, 30), at(14, 10, 30), at(14, 10, 30)},
+		{"cron moved past a blackout", schedule("0 * * * *", "11:00-13:00"), at(14, 10, 0), at(14, 9, 0), at(14, 10, 30), at(14, 13, 0)},
+		{"back to back blackouts", schedule("", "10:00-11:00", "11:00-12:00"), time.Time{}, at(14, 10, 30), at(14, 10, 30), at(14, 12, 0)},
+		{"overnight blackout", schedule("", "Sat 23:00-01:00"), time.Time{}, at(17, 23, 30), at(17, 23, 30), at(18, 1, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.schedule.Next(time.Minute, tt.last, tt.started, tt.now); !got.Equal(tt.want) {
+				t.Errorf("Next = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseBlackoutAcrossMidnight(t *testing.T) {
+	b, err := ParseBlackout("Sat 23:00-01:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sunday1am := at(18, 1, 0)
+	tests := []struct {
+		t       time.Time
+		blocked bool
+		end     time.Time
+	}{
+		{at(17, 22, 59), false, time.Time{}},
+		{at(17, 23, 0), true, sunday1am},
+		{at(17, 23, 59), true, sunday1am},
+		{at(18, 0, 0), true, sunday1am},
+		{at(18, 0, 59), true, sunday1am},
+		{at(18, 1, 0), false, time.Time{}},
+		// Sunday night is not in the window, nor is the Monday morning after it.
+		{at(18, 23, 30), false, time.Time{}},
+		{at(19, 0, 30), false, time.Time{}},
+		{at(16, 23, 30), false, time.Time{}},
+	}
+	for _, tt := range tests {
+		end, blocked := b.endIfInside(tt.t)
+		if blocked != tt.blocked || !end.Equal(tt.end) {
+			t.Errorf("%s: blocked %v until %s, want %v until %s", tt.t.Format("Mon 15:04"), blocked, end, tt.blocked, tt.end)
+		}
+	}
+}
+
+func TestParseBlackout(t *testing.T) {
+	b, err := ParseBlackout("Fri-Mon 22:00-02:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [7]bool{true, true, false, false, false, true, true}
+	if b.Days != want || b.Start != 22*60 || b.End != 2*60 {
+		t.Errorf("got days %v %d-%d, want %v %d-%d", b.Days, b.Start, b.End, want, 22*60, 2*60)
+	}
+
+	every, err := ParseBlackout("02:00-04:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if every.Days != [7]bool{true, true, true, true, true, true, true} {
+		t.Errorf("window without days covers %v, want every day", every.Days)
+	}
+
+	for _, raw := range []string{"", "01:00", "Wed 25:00-26:00", "Funday 01:00-02:00", "01:00-01:00", "Mon Tue 01:00-02:00"} {
+		if _, err := ParseBlackout(raw); err == nil {
+			t.Errorf("ParseBlackout(%q) accepted an invalid window", raw)
+		}
+	}
+}
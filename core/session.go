@@ -0,0 +1,138 @@
+package core
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Session is a logged-in dashboard user. The cookie only carries the session
+// ID and its HMAC; everything else stays server-side so logout can revoke it.
+type Session struct {
+	ID        string
+	Username  string
+	Role      string
+	CSRFToken string
+	ExpiresAt time.Time
+	// MustChangePassword is read from the user, like the role.
+	MustChangePassword bool
+}
+
+var (
+	sessionSecret []byte
+	SessionTTL    = 1 * time.Hour
+)
+
+// InitSessions loads SESSION_SECRET and SESSION_TTL_MINUTES. Without a secret
+// a random one is generated, which logs everyone out on restart.
+func InitSessions() {
+	if secret := os.Getenv("SESSION_SECRET"); secret != "" {
+		sessionSecret = []byte(secret)
+	} else {
+		sessionSecret = []byte(RandomToken(32))
+		fmt.Println("⚠️  SESSION_SECRET not set, using a random secret (sessions end on restart)")
+	}
+
+	if val, err := strconv.Atoi(os.Getenv("SESSION_TTL_MINUTES")); err == nil && val > 0 {
+		SessionTTL = time.Duration(val) * time.Minute
+	}
+}
+
+// RandomToken returns n random bytes, hex encoded.
+func RandomToken(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic("❌ crypto/rand failed: " + err.Error())
+	}
+	return hex.EncodeToString(b)
+}
+
+func signSessionID(id string) string {
+	h := hmac.New(sha256.New, sessionSecret)
+	h.Write([]byte(id))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// CreateSession stores a new session and returns it with the cookie value.
+func CreateSession(user User) (Session, string, error) {
+	if DB == nil {
+		return Session{}, "", fmt.Errorf("database not initialized")
+	}
+
+	now := time.Now()
+	sess := Session{
+		ID:        RandomToken(32),
+		Username:  user.Username,
+		Role:      user.Role,
+		CSRFToken: RandomToken(32),
+		ExpiresAt: now.Add(SessionTTL),
+
+		MustChangePassword: user.MustChangePassword,
+	}
+
+	// Expired sessions are swept whenever a new one is created.
+	if _, err := DB.Exec(`DELETE FROM sessions WHERE expires_at < ?`, now); err != nil {
+		fmt.Printf("⚠️ Failed to clean up expired sessions: %v\n", err)
+	}
+
+	_, err := DB.Exec(`INSERT INTO sessions (id, username, csrf_token, created_at, expires_at) VALUES (?, ?, ?, ?, ?)`,
+		sess.ID, sess.Username, sess.CSRFToken, now, sess.ExpiresAt)
+	if err != nil {
+		return Session{}, "", fmt.Errorf("error saving session: %w", err)
+	}
+
+	return sess, sess.ID + "." + signSessionID(sess.ID), nil
+}
+
+// ValidateSession checks the cookie signature and that the session still
+// exists and has not expired.
+func ValidateSession(token string) (Session, error) {
+	id, sig, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(signSessionID(id))) {
+		return Session{}, fmt.Errorf("invalid session token")
+	}
+	if DB == nil {
+		return Session{}, fmt.Errorf("database not initialized")
+	}
+
+	var sess Session
+	// The role is read from users on every request so role changes and
+	// deleted users take effect immediately.
+	err := DB.QueryRow(`SELECT s.id, s.username, u.role, COALESCE(u.must_change_password, 0), s.csrf_token, s.expires_at
+		FROM sessions s JOIN users u ON u.username = s.username WHERE s.id = ?`, id).
+		Scan(&sess.ID, &sess.Username, &sess.Role, &sess.MustChangePassword, &sess.CSRFToken, &sess.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return Session{}, fmt.Errorf("session not found")
+	}
+	if err != nil {
+		return Session{}, err
+	}
+
+	if time.Now().After(sess.ExpiresAt) {
+		DeleteSession(sess.ID)
+		return Session{}, fmt.Errorf("session expired")
+	}
+	return sess, nil
+}
+
+func DeleteSession(id string) {
+	if DB == nil {
+		return
+	}
+	if _, err := DB.Exec(`DELETE FROM sessions WHERE id = ?`, id); err != nil {
+		fmt.Printf("❌ Error deleting session: %v\n", err)
+	}
+}
+
+// CheckCSRF compares a submitted CSRF token with the expected one in constant time.
+func CheckCSRF(expected string, submitted string) bool {
+	return expected != "" && subtle.ConstantTimeCompare([]byte(expected), []byte(submitted)) == 1
+}
@@ -0,0 +1,409 @@
+package core
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RuntimeSettings is the effective configuration that can change while the
+// bot runs. Every change is stored as a new version in the settings table.
+type RuntimeSettings struct {
+	DryRun          bool               `json:"dry_run"`
+	Targets         map[string]float64 `json:"targets"`
+	Threshold       float64            `json:"threshold"`
+	IntervalSeconds int                `json:"interval_seconds"`
+	MinOrderTHB     float64            `json:"min_order_thb"`
+}
+
+// Where a settings version came from. SourceEnv versions snapshot the
+// environment and config file at startup, SourceReload versions come from a
+// hot reload and SourceRuntime versions are dashboard/API changes.
+const (
+	SourceEnv     = "env"
+	SourceReload  = "reload"
+	SourceRuntime = "runtime"
+)
+
+type SettingsVersion struct {
+	Version   int             `json:"version"`
+	UpdatedAt string          `json:"updated_at"`
+	UpdatedBy string          `json:"updated_by"`
+	Source    string          `json:"source"`
+	Changes   []string        `json:"changes"`
+	Settings  RuntimeSettings `json:"settings"`
+}
+
+// settingsWriteMutex serialises read-modify-write cycles on the settings so
+// two concurrent changes cannot both start from the same old version.
+var settingsWriteMutex sync.Mutex
+
+// CurrentSettings returns a copy of the live settings.
+func CurrentSettings() RuntimeSettings {
+	ConfigMutex.RLock()
+	defer ConfigMutex.RUnlock()
+
+	targets := make(map[string]float64, len(TargetAssets))
+	for asset, pct := range TargetAssets {
+		targets[asset] = pct
+	}
+	return RuntimeSettings{
+		DryRun:          IsDryRun,
+		Targets:         targets,
+		Threshold:       Threshold,
+		IntervalSeconds: int(RebalanceInterval / time.Second),
+		MinOrderTHB:     MinOrderTHB,
+	}
+}
+
+func (s RuntimeSettings) Validate() error {
+	if err := ValidateTargets(s.Targets); err != nil {
+		return err
+	}
+	for asset, pct := range s.Targets {
+		if pct < 0 {
+			return fmt.Errorf("target for %s must not be negative", asset)
+		}
+	}
+	if s.Threshold <= 0 {
+		return fmt.Errorf("threshold must be greater than 0%%")
+	}
+	if s.IntervalSeconds < 10 {
+		return fmt.Errorf("interval must be at least 10 seconds")
+	}
+	if s.MinOrderTHB < 10 {
+		return fmt.Errorf("minimum order must be at least 10 THB (Bitkub's minimum)")
+	}
+	return nil
+}
+
+func (s RuntimeSettings) apply() {
+	ConfigMutex.Lock()
+	defer ConfigMutex.Unlock()
+
+	IsDryRun = s.DryRun
+	TargetAssets = s.Targets
+	Threshold = s.Threshold
+	RebalanceInterval = time.Duration(s.IntervalSeconds) * time.Second
+	MinOrderTHB = s.MinOrderTHB
+}
+
+func (s RuntimeSettings) Mode() string {
+	if s.DryRun {
+		return "DRY_RUN"
+	}
+	return "PRODUCTION"
+}
+
+func (s RuntimeSettings) Summary() string {
+	return fmt.Sprintf("Mode %s | Targets %s | Threshold %.2f%% | Interval %ds | Min Order %.2f THB",
+		s.Mode(), FormatTargets(s.Targets), s.Threshold, s.IntervalSeconds, s.MinOrderTHB)
+}
+
+// DiffSettings describes every field that differs between two versions.
+func DiffSettings(old RuntimeSettings, updated RuntimeSettings) []string {
+	changes := []string{}
+	if old.DryRun != updated.DryRun {
+		changes = append(changes, fmt.Sprintf("mode: %s → %s", old.Mode(), updated.Mode()))
+	}
+	if !sameTargets(old.Targets, updated.Targets) {
+		changes = append(changes, fmt.Sprintf("targets: %s → %s", FormatTargets(old.Targets), FormatTargets(updated.Targets)))
+	}
+	if old.Threshold != updated.Threshold {
+		changes = append(changes, fmt.Sprintf("threshold: %.2f%% → %.2f%%", old.Threshold, updated.Threshold))
+	}
+	if old.IntervalSeconds != updated.IntervalSeconds {
+		changes = append(changes, fmt.Sprintf("interval: %ds → %ds", old.IntervalSeconds, updated.IntervalSeconds))
+	}
+	if old.MinOrderTHB != updated.MinOrderTHB {
+		changes = append(changes, fmt.Sprintf("min order: %.2f → %.2f THB", old.MinOrderTHB, updated.MinOrderTHB))
+	}
+	return changes
+}
+
+func sameTargets(a map[string]float64, b map[string]float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for asset, pct := range a {
+		if other, ok := b[asset]; !ok || math.Abs(other-pct) > 1e-9 {
+			return false
+		}
+	}
+	return true
+}
+
+// UpdateSettings validates and applies new weights, threshold, interval and
+// minimum order, stores them as a new version and announces the change on
+// Discord. The mode is left alone; it changes through SetMode.
+func UpdateSettings(s RuntimeSettings, actor string) error {
+	settingsWriteMutex.Lock()
+	defer settingsWriteMutex.Unlock()
+
+	normalized := make(map[string]float64, len(s.Targets))
+	for asset, pct := range s.Targets {
+		normalized[normalizeAssetSymbol(asset)] = pct
+	}
+	s.Targets = normalized
+	if _, ok := s.Targets["THB"]; !ok {
+		s.Targets["THB"] = 0.0
+	}
+
+	old := CurrentSettings()
+	s.DryRun = old.DryRun
+	if err := commitSettings(old, s, actor, SourceRuntime); err != nil {
+		return err
+	}
+
+	go SendDiscordSettingsChange(old, s, actor)
+	return nil
+}
+
+// SetMode switches between DRY_RUN and PRODUCTION and stores the change so
+// a restart comes back in the same mode.
+func SetMode(dryRun bool, actor string) error {
+	settingsWriteMutex.Lock()
+	defer settingsWriteMutex.Unlock()
+
+	old := CurrentSettings()
+	s := CurrentSettings()
+	s.DryRun = dryRun
+	return commitSettings(old, s, actor, SourceRuntime)
+}
+
+func commitSettings(old RuntimeSettings, s RuntimeSettings, actor string, source string) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+
+	changes := DiffSettings(old, s)
+	if len(changes) == 0 {
+		return nil
+	}
+	if err := saveSettings(s, actor, source, changes); err != nil {
+		return err
+	}
+
+	s.apply()
+	fmt.Printf("⚙️ Settings updated by %s: %s\n", actor, strings.Join(changes, ", "))
+	if old.DryRun != s.DryRun {
+		PublishEvent(EventMode, ModeEvent{Mode: modeName(s.DryRun), Actor: actor})
+	}
+	notifyPortfolioChanged()
+	return nil
+}
+
+func saveSettings(s RuntimeSettings, actor string, source string, changes []string) error {
+	return saveSettingsVersion(s, actor, source, changes, nil)
+}
+
+// saveSettingsVersion stores a version. Startup versions also carry the raw
+// env values in bootstrap so the next startup can tell which env values were
+// edited in between.
+func saveSettingsVersion(s RuntimeSettings, actor string, source string, changes []string, bootstrap *RuntimeSettings) error {
+	if DB == nil {
+		return fmt.Errorf("database not initialized")
+	}
+
+	payload, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	changesJSON, _ := json.Marshal(changes)
+
+	var bootstrapJSON interface{}
+	if bootstrap != nil {
+		raw, err := json.Marshal(bootstrap)
+		if err != nil {
+			return err
+		}
+		bootstrapJSON = string(raw)
+	}
+
+	_, err = DB.Exec(`INSERT INTO settings (updated_at, updated_by, payload, source, changes, bootstrap) VALUES (?, ?, ?, ?, ?, ?)`,
+		time.Now(), actor, string(payload), source, string(changesJSON), bootstrapJSON)
+	if err != nil {
+		return fmt.Errorf("error saving settings: %w", err)
+	}
+	return nil
+}
+
+// decodeSettings reads a stored payload. Fields missing from payloads
+// written by older versions keep the values in base.
+func decodeSettings(payload string, base RuntimeSettings) (RuntimeSettings, error) {
+	s := base
+	s.Targets = nil
+	if err := json.Unmarshal([]byte(payload), &s); err != nil {
+		return s, err
+	}
+	if s.Targets == nil {
+		s.Targets = base.Targets
+	}
+	return s, nil
+}
+
+// latestSettings returns the newest stored version, or nil if there is none.
+func latestSettings(base RuntimeSettings) (*SettingsVersion, error) {
+	var v SettingsVersion
+	var payload string
+	var updatedAt time.Time
+	err := DB.QueryRow(`SELECT id, updated_at, updated_by, payload, COALESCE(source, ?) FROM settings ORDER BY id DESC LIMIT 1`,
+		SourceRuntime).Scan(&v.Version, &updatedAt, &v.UpdatedBy, &payload, &v.Source)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	v.UpdatedAt = updatedAt.Format("02/01/2006 15:04:05")
+	if v.Settings, err = decodeSettings(payload, base); err != nil {
+		return nil, fmt.Errorf("error decoding settings version %d: %w", v.Version, err)
+	}
+	return &v, nil
+}
+
+// lastBootstrap returns the env values seen at the previous startup.
+func lastBootstrap(base RuntimeSettings) (*RuntimeSettings, error) {
+	var payload string
+	err := DB.QueryRow(`SELECT bootstrap FROM settings WHERE bootstrap IS NOT NULL ORDER BY id DESC LIMIT 1`).Scan(&payload)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := decodeSettings(payload, base)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding startup settings: %w", err)
+	}
+	return &s, nil
+}
+
+// InitSettings decides the effective settings at startup. The rule is:
+//
+//  1. The latest saved version wins, so a mode or weight changed on the
+//     dashboard survives a restart even though IS_DRY_RUN etc. still hold
+//     the old values.
+//  2. Except for fields whose env value changed since the last startup;
+//     editing .env is an explicit change and takes effect for those fields.
+//  3. SETTINGS_FROM_ENV=true ignores the saved versions and uses env as is.
+//
+// Whatever comes out is stored as a new version when env changed.
+func InitSettings() error {
+	if DB == nil {
+		return fmt.Errorf("database not initialized")
+	}
+
+	settingsWriteMutex.Lock()
+	defer settingsWriteMutex.Unlock()
+
+	env := CurrentSettings()
+
+	latest, err := latestSettings(env)
+	if err != nil {
+		return err
+	}
+	previousEnv, err := lastBootstrap(env)
+	if err != nil {
+		return err
+	}
+
+	if forced, _ := strconv.ParseBool(os.Getenv("SETTINGS_FROM_ENV")); forced || latest == nil {
+		old := env
+		if latest != nil {
+			old = latest.Settings
+			fmt.Println("⚠️ SETTINGS_FROM_ENV=true: ignoring saved settings")
+		}
+		if err := saveSettingsVersion(env, "startup", SourceEnv, DiffSettings(old, env), &env); err != nil {
+			return err
+		}
+		fmt.Printf("⚙️ Using settings from environment: %s\n", env.Summary())
+		return nil
+	}
+
+	effective := mergeBootstrap(latest.Settings, previousEnv, env)
+
+	merged := CurrentConfig()
+	merged.setRuntimeSettings(effective)
+	if errs := merged.Validate(); len(errs) > 0 {
+		// Falling back to env could quietly switch a dashboard DRY_RUN back to
+		// PRODUCTION, so refuse to start instead.
+		return fmt.Errorf("saved settings (last changed by %s at %s) do not fit the current config; "+
+			"fix the config or set SETTINGS_FROM_ENV=true to start from env: %w", latest.UpdatedBy, latest.UpdatedAt, ConfigErrors(errs))
+	}
+
+	if previousEnv == nil || len(DiffSettings(*previousEnv, env)) > 0 {
+		changes := DiffSettings(latest.Settings, effective)
+		if err := saveSettingsVersion(effective, "startup", SourceEnv, changes, &env); err != nil {
+			return err
+		}
+		if len(changes) > 0 {
+			fmt.Printf("⚙️ Environment changed since last start: %s\n", strings.Join(changes, ", "))
+		}
+	}
+
+	effective.apply()
+	fmt.Printf("♻️ Using saved settings (last changed by %s at %s): %s\n", latest.UpdatedBy, latest.UpdatedAt, effective.Summary())
+	return nil
+}
+
+// mergeBootstrap applies the env/file values that changed since previous
+// was loaded on top of current, leaving every other field as it is.
+func mergeBootstrap(current RuntimeSettings, previous *RuntimeSettings, env RuntimeSettings) RuntimeSettings {
+	if previous == nil {
+		return current
+	}
+	if env.DryRun != previous.DryRun {
+		current.DryRun = env.DryRun
+	}
+	if !sameTargets(env.Targets, previous.Targets) {
+		current.Targets = env.Targets
+	}
+	if env.Threshold != previous.Threshold {
+		current.Threshold = env.Threshold
+	}
+	if env.IntervalSeconds != previous.IntervalSeconds {
+		current.IntervalSeconds = env.IntervalSeconds
+	}
+	if env.MinOrderTHB != previous.MinOrderTHB {
+		current.MinOrderTHB = env.MinOrderTHB
+	}
+	return current
+}
+
+// SettingsHistory returns the newest versions first.
+func SettingsHistory(limit int) ([]SettingsVersion, error) {
+	if DB == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	rows, err := DB.Query(`SELECT id, updated_at, updated_by, payload, COALESCE(source, ?), COALESCE(changes, '[]')
+		FROM settings ORDER BY id DESC LIMIT ?`, SourceRuntime, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := []SettingsVersion{}
+	for rows.Next() {
+		var v SettingsVersion
+		var updatedAt time.Time
+		var payload, changes string
+		if err := rows.Scan(&v.Version, &updatedAt, &v.UpdatedBy, &payload, &v.Source, &changes); err != nil {
+			return nil, err
+		}
+		v.UpdatedAt = updatedAt.Format("02/01/2006 15:04:05")
+		json.Unmarshal([]byte(payload), &v.Settings)
+		json.Unmarshal([]byte(changes), &v.Changes)
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
@@ -0,0 +1,355 @@
+package core
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Strategy decides which assets to trade on a rebalance check. Plan returns
+// one TradePlan per coin; plans with an empty Operation are left alone.
+// Calendar-based strategies mark the period they act in on state; the
+// caller keeps it between checks, and only once the period's trades went
+// through, so a period whose trades failed is planned again.
+type Strategy interface {
+	Name() string
+	Plan(summary PortfolioSummary, now time.Time, state *StrategyState) []TradePlan
+}
+
+type StrategyState struct {
+	LastPeriod string
+}
+
+// Strategy types.
+const (
+	StrategyThreshold    = "threshold"
+	StrategyRelativeBand = "relative_band"
+	StrategyPeriodic     = "periodic"
+	StrategyHybrid       = "hybrid"
+)
+
+// StrategyConfig selects and tunes the strategy for the portfolio.
+type StrategyConfig struct {
+	Type    string
+	Period  string  // daily, weekly or monthly (periodic, hybrid)
+	BandPct float64 // deviation as % of the target weight (relative_band, hybrid)
+	Sizing  Sizing
+}
+
+// Sizing modes.
+const (
+	SizingFull     = "full"
+	SizingBandEdge = "band"
+	SizingFraction = "fraction"
+)
+
+// Sizing decides how much of the gap a triggered trade closes: all of it
+// (back to target), just enough to get back inside the band, or Fraction of
+// it. Trading less pays less fee and turnover at the cost of triggering
+// again sooner. Strategies without a band (periodic) always trade in full
+// with SizingBandEdge.
+type Sizing struct {
+	Mode     string
+	Fraction float64
+}
+
+func (s Sizing) validate() error {
+	switch s.Mode {
+	case "", SizingFull, SizingBandEdge:
+		return nil
+	case SizingFraction:
+		if s.Fraction <= 0 || s.Fraction > 1 {
+			return fmt.Errorf("rebalance fraction must be greater than 0 and at most 1, got %g", s.Fraction)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown rebalance sizing %q (full, band or fraction)", s.Mode)
+}
+
+// gap returns how many percentage points to trade for an asset that is
+// deviation points away from target, with band points of tolerance.
+func (s Sizing) gap(deviation float64, band float64) float64 {
+	switch s.Mode {
+	case SizingBandEdge:
+		if band > 0 && band < deviation {
+			return deviation - band
+		}
+	case SizingFraction:
+		return deviation * s.Fraction
+	}
+	return deviation
+}
+
+func (s Sizing) describe() string {
+	switch s.Mode {
+	case SizingBandEdge:
+		return ", to band edge"
+	case SizingFraction:
+		return fmt.Sprintf(", %.0f%% of gap", s.Fraction*100.0)
+	}
+	return ""
+}
+
+// NewStrategy builds the strategy described by cfg. threshold is the
+// absolute deviation used by the threshold strategy; loc decides where
+// calendar periods start.
+func NewStrategy(cfg StrategyConfig, threshold float64, minOrderTHB float64, loc *time.Location) (Strategy, error) {
+	if loc == nil {
+		loc = time.Local
+	}
+
+	needsPeriod := cfg.Type == StrategyPeriodic || cfg.Type == StrategyHybrid
+	if needsPeriod && cfg.Period != "daily" && cfg.Period != "weekly" && cfg.Period != "monthly" {
+		return nil, fmt.Errorf("strategy period must be daily, weekly or monthly, got %q", cfg.Period)
+	}
+	needsBand := cfg.Type == StrategyRelativeBand || cfg.Type == StrategyHybrid
+	if needsBand && cfg.BandPct <= 0 {
+		return nil, fmt.Errorf("strategy band must be greater than 0%%")
+	}
+	if err := cfg.Sizing.validate(); err != nil {
+		return nil, err
+	}
+
+	band := RelativeBandStrategy{BandPct: cfg.BandPct, MinOrderTHB: minOrderTHB, Sizing: cfg.Sizing}
+	switch cfg.Type {
+	case "", StrategyThreshold:
+		return ThresholdStrategy{Threshold: threshold, MinOrderTHB: minOrderTHB, Sizing: cfg.Sizing}, nil
+	case StrategyRelativeBand:
+		return band, nil
+	case StrategyPeriodic:
+		return PeriodicStrategy{Period: cfg.Period, Location: loc, MinOrderTHB: minOrderTHB, Sizing: cfg.Sizing}, nil
+	case StrategyHybrid:
+		return HybridStrategy{Period: cfg.Period, Location: loc, Band: band}, nil
+	}
+	return nil, fmt.Errorf("unknown strategy %q (threshold, relative_band, periodic or hybrid)", cfg.Type)
+}
+
+// ThresholdStrategy trades an asset once its weight is more than Threshold
+// percentage points away from the target.
+type ThresholdStrategy struct {
+	Threshold   float64
+	MinOrderTHB float64
+	Sizing      Sizing
+}
+
+func (s ThresholdStrategy) Name() string {
+	return fmt.Sprintf("threshold %.2f%%%s", s.Threshold, s.Sizing.describe())
+}
+
+func (s ThresholdStrategy) Plan(summary PortfolioSummary, now time.Time, state *StrategyState) []TradePlan {
+	return planWith(summary, s.MinOrderTHB, s.Sizing, thresholdTrigger(s.Threshold))
+}
+
+// RelativeBandStrategy trades an asset once its deviation is more than
+// BandPct of its own target, so a 10% target with a 25% band trades outside
+// 7.5%-12.5% while a 50% target trades outside 37.5%-62.5%.
+type RelativeBandStrategy struct {
+	BandPct     float64
+	MinOrderTHB float64
+	Sizing      Sizing
+}
+
+func (s RelativeBandStrategy) Name() string {
+	return fmt.Sprintf("relative band %.2f%% of target%s", s.BandPct, s.Sizing.describe())
+}
+
+func (s RelativeBandStrategy) Plan(summary PortfolioSummary, now time.Time, state *StrategyState) []TradePlan {
+	return planWith(summary, s.MinOrderTHB, s.Sizing, func(asset AssetData, deviation float64) (string, float64) {
+		if asset.TargetPct <= 0 {
+			if asset.ActualPct > 0 {
+				return fmt.Sprintf("%.2f%% held with a 0%% target", asset.ActualPct), 0
+			}
+			return "", 0
+		}
+		relative := deviation / asset.TargetPct * 100.0
+		if relative <= s.BandPct {
+			return "", 0
+		}
+		return fmt.Sprintf("เบี่ยงเบน %.2f%% ของเป้าหมาย > band %.2f%%", relative, s.BandPct), asset.TargetPct * s.BandPct / 100.0
+	})
+}
+
+// PeriodicStrategy brings every asset back to target on the first check of
+// each day, week or month, however small the drift. Differences worth less
+// than the minimum order are left alone.
+type PeriodicStrategy struct {
+	Period      string
+	Location    *time.Location
+	MinOrderTHB float64
+	Sizing      Sizing
+}
+
+func (s PeriodicStrategy) Name() string {
+	return fmt.Sprintf("periodic (%s%s)", s.Period, s.Sizing.describe())
+}
+
+func (s PeriodicStrategy) Plan(summary PortfolioSummary, now time.Time, state *StrategyState) []TradePlan {
+	period := periodKey(s.Period, now.In(s.Location))
+	due := state.LastPeriod != period
+	if due {
+		state.LastPeriod = period
+	}
+
+	return planWith(summary, s.MinOrderTHB, s.Sizing, func(asset AssetData, deviation float64) (string, float64) {
+		if !due || deviation/100.0*summary.TotalValue < s.MinOrderTHB {
+			return "", 0
+		}
+		return fmt.Sprintf("rebalance ตามรอบ %s (%s)", s.Period, period), 0
+	})
+}
+
+// HybridStrategy only looks at the portfolio on the first check of each
+// period and then trades just the assets outside the relative band.
+type HybridStrategy struct {
+	Period   string
+	Location *time.Location
+	Band     RelativeBandStrategy
+}
+
+func (s HybridStrategy) Name() string {
+	return fmt.Sprintf("hybrid (%s, band %.2f%% of target%s)", s.Period, s.Band.BandPct, s.Band.Sizing.describe())
+}
+
+func (s HybridStrategy) Plan(summary PortfolioSummary, now time.Time, state *StrategyState) []TradePlan {
+	period := periodKey(s.Period, now.In(s.Location))
+	if state.LastPeriod == period {
+		return planWith(summary, s.Band.MinOrderTHB, s.Band.Sizing, func(AssetData, float64) (string, float64) { return "", 0 })
+	}
+	state.LastPeriod = period
+	return s.Band.Plan(summary, now, state)
+}
+
+// periodKey names the calendar period t falls in.
+func periodKey(period string, t time.Time) string {
+	switch period {
+	case "daily":
+		return t.Format("2006-01-02")
+	case "weekly":
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	}
+	return t.Format("2006-01")
+}
+
+// PlanRebalance decides what to trade for every non-THB asset in the
+// portfolio. Assets within the threshold get a plan with an empty Operation.
+// Sells are ordered before buys so the THB they free up can fund the buys.
+func PlanRebalance(summary PortfolioSummary, threshold float64, minOrderTHB float64) []TradePlan {
+	return planWith(summary, minOrderTHB, Sizing{Mode: SizingFull}, thresholdTrigger(threshold))
+}
+
+func thresholdTrigger(threshold float64) func(AssetData, float64) (string, float64) {
+	return func(asset AssetData, deviation float64) (string, float64) {
+		if deviation <= threshold {
+			return "", 0
+		}
+		return fmt.Sprintf("เบี่ยงเบน %.2f%% > THRESHOLD %.2f%%", deviation, threshold), threshold
+	}
+}
+
+// planWith builds the plans shared by every strategy. trigger returns why an
+// asset should be traded, or "" to leave it alone, and the deviation it
+// tolerates, which sizing uses to stop at the band edge.
+func planWith(summary PortfolioSummary, minOrderTHB float64, sizing Sizing,
+	trigger func(asset AssetData, deviation float64) (string, float64)) []TradePlan {
+	plans := []TradePlan{}
+
+	for _, assetData := range summary.Portfolio {
+		if assetData.Asset == "THB" {
+			continue
+		}
+
+		diff := assetData.ActualPct - assetData.TargetPct
+		plan := TradePlan{
+			Asset:     assetData.Asset,
+			Price:     assetData.CurrentPrice,
+			ActualPct: assetData.ActualPct,
+			TargetPct: assetData.TargetPct,
+			Deviation: math.Abs(diff),
+		}
+
+		reason, band := trigger(assetData, plan.Deviation)
+		plan.Reason = reason
+		if plan.Reason == "" || diff == 0 {
+			plan.Reason = ""
+			plans = append(plans, plan)
+			continue
+		}
+
+		if diff > 0 {
+			plan.Operation = "sell"
+		} else {
+			plan.Operation = "buy"
+		}
+		plan.FullAmountTHB = RoundFloat((plan.Deviation/100.0)*summary.TotalValue, 2)
+		plan.AmountTHB = RoundFloat((sizing.gap(plan.Deviation, band)/100.0)*summary.TotalValue, 2)
+
+		if assetData.CurrentPrice <= 0 {
+			plan.Skip = SkipZeroPrice
+			plans = append(plans, plan)
+			continue
+		}
+
+		plan.CoinAmount = RoundFloat(plan.AmountTHB/assetData.CurrentPrice, 8)
+		// Bitkub rejects small sells as well as small buys.
+		if plan.AmountTHB < minOrderTHB {
+			plan.Skip = SkipBelowMinimum
+		}
+		plans = append(plans, plan)
+	}
+
+	sort.SliceStable(plans, func(i, j int) bool {
+		return plans[i].ActualPct-plans[i].TargetPct > plans[j].ActualPct-plans[j].TargetPct
+	})
+	return plans
+}
+
+// CurrentStrategy builds the strategy from the live config.
+func CurrentStrategy() (Strategy, error) {
+	ConfigMutex.RLock()
+	defer ConfigMutex.RUnlock()
+	cfg := StrategyConfig{
+		Type:    StrategyType,
+		Period:  StrategyPeriod,
+		BandPct: StrategyBandPct,
+		Sizing:  Sizing{Mode: RebalanceSizing, Fraction: RebalanceFraction},
+	}
+	return NewStrategy(cfg, Threshold, MinOrderTHB, RebalanceSchedule.Location)
+}
+
+// StrategySummary describes the strategy currently in effect.
+func StrategySummary() string {
+	strategy, err := CurrentStrategy()
+	if err != nil {
+		return "invalid strategy: " + err.Error()
+	}
+	return strategy.Name()
+}
+
+// loadStrategyState reads the state of the calendar strategies. DRY_RUN and
+// PRODUCTION trade different wallets, so each mode keeps its own.
+func loadStrategyState(mode string) StrategyState {
+	state := StrategyState{}
+	if DB == nil {
+		return state
+	}
+	err := DB.QueryRow(`SELECT last_period FROM strategy_state WHERE mode = ?`, mode).Scan(&state.LastPeriod)
+	if err != nil && err != sql.ErrNoRows {
+		fmt.Printf("⚠️ Failed to load strategy state: %v\n", err)
+	}
+	return state
+}
+
+func saveStrategyState(mode string, state StrategyState) {
+	if DB == nil {
+		return
+	}
+	_, err := DB.Exec(`INSERT INTO strategy_state (mode, last_period, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT(mode) DO UPDATE SET last_period = excluded.last_period, updated_at = excluded.updated_at`,
+		mode, state.LastPeriod, time.Now())
+	if err != nil {
+		fmt.Printf("⚠️ Failed to save strategy state: %v\n", err)
+	}
+}
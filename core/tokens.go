@@ -0,0 +1,124 @@
+package core
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// API token scopes. A control token can do everything a read token can,
+// and may also read the audit log.
+const (
+	ScopeRead    = "read"
+	ScopeControl = "control"
+	ScopeAudit   = "audit"
+)
+
+// APIToken is a bearer token for scripts. Only the SHA-256 of the token is
+// stored, so a leaked database does not leak usable tokens.
+type APIToken struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Scope      string     `json:"scope"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Revoked    bool       `json:"revoked"`
+}
+
+func (t APIToken) Allows(scope string) bool {
+	return t.Scope == ScopeControl || t.Scope == scope
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateAPIToken stores a new token and returns the plaintext, which is
+// shown once and never stored.
+func CreateAPIToken(name string, scope string) (string, error) {
+	if DB == nil {
+		return "", fmt.Errorf("database not initialized")
+	}
+	if scope != ScopeRead && scope != ScopeControl {
+		return "", fmt.Errorf("invalid scope %q: must be %q or %q", scope, ScopeRead, ScopeControl)
+	}
+	if name == "" {
+		return "", fmt.Errorf("token name is required")
+	}
+
+	token := "bkb_" + RandomToken(24)
+	_, err := DB.Exec(`INSERT INTO api_tokens (name, token_hash, scope, created_at, revoked) VALUES (?, ?, ?, ?, 0)`,
+		name, hashToken(token), scope, time.Now())
+	if err != nil {
+		return "", fmt.Errorf("error saving API token: %w", err)
+	}
+	return token, nil
+}
+
+func ValidateAPIToken(token string) (APIToken, error) {
+	if DB == nil {
+		return APIToken{}, fmt.Errorf("database not initialized")
+	}
+
+	var t APIToken
+	err := DB.QueryRow(`SELECT id, name, scope, created_at, revoked FROM api_tokens WHERE token_hash = ?`, hashToken(token)).
+		Scan(&t.ID, &t.Name, &t.Scope, &t.CreatedAt, &t.Revoked)
+	if err == sql.ErrNoRows {
+		return APIToken{}, fmt.Errorf("unknown API token")
+	}
+	if err != nil {
+		return APIToken{}, err
+	}
+	if t.Revoked {
+		return APIToken{}, fmt.Errorf("API token %q has been revoked", t.Name)
+	}
+
+	if _, err := DB.Exec(`UPDATE api_tokens SET last_used_at = ? WHERE id = ?`, time.Now(), t.ID); err != nil {
+		fmt.Printf("⚠️ Failed to update API token usage: %v\n", err)
+	}
+	return t, nil
+}
+
+func ListAPITokens() ([]APIToken, error) {
+	if DB == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	rows, err := DB.Query(`SELECT id, name, scope, created_at, last_used_at, revoked FROM api_tokens ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []APIToken{}
+	for rows.Next() {
+		var t APIToken
+		var lastUsed sql.NullTime
+		if err := rows.Scan(&t.ID, &t.Name, &t.Scope, &t.CreatedAt, &lastUsed, &t.Revoked); err != nil {
+			return nil, err
+		}
+		if lastUsed.Valid {
+			t.LastUsedAt = &lastUsed.Time
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+func RevokeAPIToken(id int) error {
+	if DB == nil {
+		return fmt.Errorf("database not initialized")
+	}
+
+	res, err := DB.Exec(`UPDATE api_tokens SET revoked = 1 WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("API token %d not found", id)
+	}
+	return nil
+}
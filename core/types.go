@@ -9,6 +9,32 @@ type TradeRecord struct {
 	CoinAmount float64 `json:"coin_amount"`
 	Price      float64 `json:"price"`
 	Deviation  float64 `json:"deviation"`
+	FillPrice  float64 `json:"fill_price"`
+	OrderID    string  `json:"order_id"`
+	Fee        float64 `json:"fee"`
+	Received   float64 `json:"received"`
+}
+
+// TradeLog is one row written to the trades table. Price is the ticker price
+// the decision was made at; FillPrice is what the exchange actually filled at.
+type TradeLog struct {
+	Asset      string
+	Operation  string
+	AmountTHB  float64
+	CoinAmount float64
+	Price      float64
+	FillPrice  float64
+	Mode       string
+	Deviation  float64
+	LogMessage string
+
+	// Taken from Bitkub's place-bid/place-ask result.
+	OrderID   string
+	OrderHash string
+	Received  float64
+	Fee       float64
+	Credit    float64
+	Rate      float64
 }
 
 type AssetData struct {
@@ -20,13 +46,102 @@ type AssetData struct {
 	TargetPct    float64 `json:"target_pct"`
 }
 
+// TradePlan is the rebalance decision for one asset. Operation is empty when
+// the asset is within the threshold; Skip explains why a decided trade is not
+// sent.
+type TradePlan struct {
+	Asset      string
+	Operation  string
+	AmountTHB  float64
+	CoinAmount float64
+	Price      float64
+	ActualPct  float64
+	TargetPct  float64
+	Deviation  float64
+	Reason     string
+	Skip       string
+
+	// FullAmountTHB is what trading all the way back to target would cost;
+	// it is more than AmountTHB when the sizing trades only part of the gap.
+	FullAmountTHB float64
+}
+
+// TradeDCABuy is the trades.operation of a DCA buy, which is new cash being
+// invested rather than a rebalance.
+const TradeDCABuy = "dca_buy"
+
+const (
+	SkipZeroPrice    = "zero_price"
+	SkipBelowMinimum = "below_minimum"
+)
+
+// OrderAmount is the amount Bitkub expects for the order: THB for buys and
+// coin units for sells.
+func (p TradePlan) OrderAmount() float64 {
+	if p.Operation == "buy" {
+		return p.AmountTHB
+	}
+	return p.CoinAmount
+}
+
 type PortfolioSummary struct {
 	TotalValue float64
 	ROI        float64
 	Portfolio  []AssetData
 }
 
-var walletResp struct {
+type walletResponse struct {
 	Error  float64            `json:"error"`
 	Result map[string]float64 `json:"result"`
 }
+
+type placeOrderResponse struct {
+	Error  float64 `json:"error"`
+	Result struct {
+		ID       string  `json:"id"`
+		Hash     string  `json:"hash"`
+		Type     string  `json:"typ"`
+		Amt      float64 `json:"amt"`
+		Rate     float64 `json:"rat"`
+		Fee      float64 `json:"fee"`
+		Credit   float64 `json:"cre"`
+		Received float64 `json:"rec"`
+		TS       string  `json:"ts"`
+	} `json:"result"`
+}
+
+type fiatHistoryResponse struct {
+	Error  float64 `json:"error"`
+	Result []struct {
+		TxnID    string    `json:"txn_id"`
+		Currency string    `json:"currency"`
+		Amount   flexFloat `json:"amount"`
+		Fee      flexFloat `json:"fee"`
+		Status   string    `json:"status"`
+		Time     int64     `json:"time"`
+	} `json:"result"`
+	Pagination struct {
+		Page int `json:"page"`
+		Last int `json:"last"`
+	} `json:"pagination"`
+}
+
+type orderInfoResponse struct {
+	Error  float64 `json:"error"`
+	Result struct {
+		ID        string  `json:"id"`
+		Side      string  `json:"side"`
+		Status    string  `json:"status"`
+		Amount    float64 `json:"amount"`
+		Filled    float64 `json:"filled"`
+		Remaining float64 `json:"remaining"`
+		Rate      float64 `json:"rate"`
+		Fee       float64 `json:"fee"`
+		History   []struct {
+			Amount float64 `json:"amount"`
+			Rate   float64 `json:"rate"`
+			Fee    float64 `json:"fee"`
+			Credit float64 `json:"credit"`
+		} `json:"history"`
+	} `json:"result"`
+}
@@ -0,0 +1,240 @@
+package core
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Dashboard roles. Viewers can only look; operators can also change the
+// bot's mode and settings; admins can do everything.
+const (
+	RoleViewer   = "viewer"
+	RoleOperator = "operator"
+	RoleAdmin    = "admin"
+)
+
+// MinPasswordLength applies to every password set from the CLI or the
+// dashboard.
+const MinPasswordLength = 8
+
+type User struct {
+	ID        int       `json:"id"`
+	Username  string    `json:"username"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+	// MustChangePassword keeps the user on the change password page until
+	// a new password is set.
+	MustChangePassword bool `json:"must_change_password"`
+}
+
+func ValidRole(role string) bool {
+	return role == RoleViewer || role == RoleOperator || role == RoleAdmin
+}
+
+// RoleAllows maps a dashboard role onto the API token scopes.
+func RoleAllows(role string, scope string) bool {
+	switch scope {
+	case ScopeRead:
+		return ValidRole(role)
+	case ScopeControl:
+		return role == RoleOperator || role == RoleAdmin
+	case ScopeAudit:
+		return role == RoleAdmin
+	}
+	return false
+}
+
+// dummyHash is compared against when the username does not exist so that
+// unknown users take as long to reject as wrong passwords.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("not-a-real-password"), bcrypt.DefaultCost)
+
+func Authenticate(username string, password string) (User, error) {
+	if DB == nil {
+		return User{}, fmt.Errorf("database not initialized")
+	}
+
+	var u User
+	var hash []byte
+	err := DB.QueryRow(`SELECT id, username, role, created_at, COALESCE(must_change_password, 0), password_hash FROM users WHERE username = ?`, username).
+		Scan(&u.ID, &u.Username, &u.Role, &u.CreatedAt, &u.MustChangePassword, &hash)
+	if err == sql.ErrNoRows {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return User{}, fmt.Errorf("invalid credentials")
+	}
+	if err != nil {
+		return User{}, err
+	}
+
+	if bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil {
+		return User{}, fmt.Errorf("invalid credentials")
+	}
+	return u, nil
+}
+
+// SaveUser creates the user or, if it exists, replaces its password and role.
+func SaveUser(username string, password string, role string) error {
+	if len(password) < MinPasswordLength {
+		return fmt.Errorf("password must be at least %d characters", MinPasswordLength)
+	}
+	return storeUser(username, password, role, false)
+}
+
+// storeUser saves the user without checking the password length; only the
+// bootstrap admin may start with a short one, and it must change it.
+func storeUser(username string, password string, role string, mustChange bool) error {
+	if DB == nil {
+		return fmt.Errorf("database not initialized")
+	}
+	if username == "" {
+		return fmt.Errorf("username is required")
+	}
+	if password == "" {
+		return fmt.Errorf("password is required")
+	}
+	if !ValidRole(role) {
+		return fmt.Errorf("invalid role %q: must be %s, %s or %s", role, RoleViewer, RoleOperator, RoleAdmin)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("error hashing password: %w", err)
+	}
+
+	now := time.Now()
+	_, err = DB.Exec(`INSERT INTO users (username, password_hash, role, must_change_password, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(username) DO UPDATE SET password_hash = excluded.password_hash, role = excluded.role,
+			must_change_password = excluded.must_change_password, updated_at = excluded.updated_at`,
+		username, hash, role, mustChange, now, now)
+	if err != nil {
+		return fmt.Errorf("error saving user: %w", err)
+	}
+	return nil
+}
+
+// CreateUser adds a new user. An existing user is never replaced; their
+// password and role are changed with SetUserPassword and SetUserRole.
+func CreateUser(username string, password string, role string) error {
+	if DB == nil {
+		return fmt.Errorf("database not initialized")
+	}
+	var count int
+	if err := DB.QueryRow(`SELECT COUNT(*) FROM users WHERE username = ?`, username).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("user %q already exists (use \"user reset\" to change the password or \"user role\" to change the role)", username)
+	}
+	return SaveUser(username, password, role)
+}
+
+// SetUserRole changes a user's role. Sessions read the role on every
+// request, so it applies immediately.
+func SetUserRole(username string, role string) error {
+	if !ValidRole(role) {
+		return fmt.Errorf("invalid role %q: must be %s, %s or %s", role, RoleViewer, RoleOperator, RoleAdmin)
+	}
+	res, err := DB.Exec(`UPDATE users SET role = ?, updated_at = ? WHERE username = ?`, role, time.Now(), username)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("user %q not found", username)
+	}
+	return nil
+}
+
+// SetUserPassword resets a user's password, keeping the role.
+func SetUserPassword(username string, password string) error {
+	var role string
+	if err := DB.QueryRow(`SELECT role FROM users WHERE username = ?`, username).Scan(&role); err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("user %q not found", username)
+		}
+		return err
+	}
+	if err := SaveUser(username, password, role); err != nil {
+		return err
+	}
+
+	// A password reset logs the user out everywhere.
+	_, err := DB.Exec(`DELETE FROM sessions WHERE username = ?`, username)
+	return err
+}
+
+// ChangePassword lets a logged-in user replace their own password. Like a
+// reset, it logs the user out everywhere.
+func ChangePassword(username string, current string, password string) error {
+	user, err := Authenticate(username, current)
+	if err != nil {
+		return fmt.Errorf("current password is wrong")
+	}
+	if password == current {
+		return fmt.Errorf("new password must differ from the current one")
+	}
+	if err := SaveUser(username, password, user.Role); err != nil {
+		return err
+	}
+	_, err = DB.Exec(`DELETE FROM sessions WHERE username = ?`, username)
+	return err
+}
+
+func DeleteUser(username string) error {
+	res, err := DB.Exec(`DELETE FROM users WHERE username = ?`, username)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("user %q not found", username)
+	}
+	_, err = DB.Exec(`DELETE FROM sessions WHERE username = ?`, username)
+	return err
+}
+
+func ListUsers() ([]User, error) {
+	rows, err := DB.Query(`SELECT id, username, role, created_at FROM users ORDER BY username`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		var u User
+		if err := rows.Scan(&u.ID, &u.Username, &u.Role, &u.CreatedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// EnsureBootstrapUser creates an admin from BOT_USERNAME/BOT_PASSWORD when
+// the users table is empty, so existing deployments keep their login.
+func EnsureBootstrapUser(username string, password string) error {
+	var count int
+	if err := DB.QueryRow(`SELECT COUNT(*) FROM users`).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	if username == "" || password == "" {
+		fmt.Println("⚠️  No dashboard users yet. Create one with: user create -username NAME -role admin")
+		return nil
+	}
+
+	// Older setups shipped with a short BOT_PASSWORD; they keep their login
+	// but have to pick a proper password at the first login.
+	mustChange := len(password) < MinPasswordLength
+	if err := storeUser(username, password, RoleAdmin, mustChange); err != nil {
+		return fmt.Errorf("error creating admin from BOT_USERNAME/BOT_PASSWORD: %w", err)
+	}
+	fmt.Printf("👤 Created admin user %q from BOT_USERNAME/BOT_PASSWORD. BOT_PASSWORD is no longer read once users exist.\n", username)
+	if mustChange {
+		fmt.Printf("⚠️  BOT_PASSWORD is shorter than %d characters: %q must set a new password at the first login\n", MinPasswordLength, username)
+	}
+	return nil
+}
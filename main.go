@@ -2,9 +2,16 @@ package main
 
 import (
 	"bitkub2-go/core"
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -16,7 +23,15 @@ func main() {
 	if err != nil {
 		fmt.Println("⚠️  Warning: .env file not found (Are you using Docker env vars?)")
 	}
-	core.LoadConfig()
+
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1], os.Args[2:]))
+	}
+
+	if err := core.LoadConfig(); err != nil {
+		fmt.Printf("❌ Invalid configuration, bot not started\n%v\n", err)
+		os.Exit(1)
+	}
 
 	if err := core.InitDB(os.Getenv("DB_PATH")); err != nil {
 		fmt.Printf("Fatal error during DB initialization: %v\n", err)
@@ -24,76 +39,186 @@ func main() {
 	}
 	defer core.DB.Close()
 
-	username := os.Getenv("BOT_USERNAME")
-	password := os.Getenv("BOT_PASSWORD")
+	if err := core.InitSettings(); err != nil {
+		fmt.Printf("Fatal error during settings setup: %v\n", err)
+		return
+	}
+
+	if err := core.InitCashFlows(); err != nil {
+		fmt.Printf("Fatal error during cash flow setup: %v\n", err)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	live := core.NewBitkubExchange(ctx, core.APIUrl, core.APIKey, core.APISecret)
+	venue := core.Venue{
+		Live:  live,
+		Paper: core.NewPaperExchange(live, core.PaperFeePct, core.PaperSlippagePct),
+	}
+
+	core.InitSessions()
+	core.InitLoginLimiters()
+
+	if err := core.EnsureBootstrapUser(os.Getenv("BOT_USERNAME"), os.Getenv("BOT_PASSWORD")); err != nil {
+		fmt.Printf("Fatal error during user setup: %v\n", err)
+		return
+	}
 
 	r := gin.Default()
+	// Only trust X-Forwarded-For from configured proxies, otherwise anyone
+	// could dodge the per-IP login throttle by sending the header.
+	if err := r.SetTrustedProxies(trustedProxies()); err != nil {
+		fmt.Printf("Fatal error in TRUSTED_PROXIES: %v\n", err)
+		return
+	}
 	r.Static("/static", "./templates")
 	r.LoadHTMLGlob("templates/layout/*")
 
+	renderLogin := func(c *gin.Context, status int, errMsg string) {
+		loginCSRF := core.RandomToken(16)
+		setCookie(c, loginCSRFCookie, loginCSRF, 600)
+		c.HTML(status, "login.html", gin.H{"Error": errMsg, "CSRFToken": loginCSRF})
+	}
+
+	renderPassword := func(c *gin.Context, status int, errMsg string) {
+		sess := c.MustGet("session").(core.Session)
+		c.HTML(status, "password.html", gin.H{
+			"Error":     errMsg,
+			"Username":  sess.Username,
+			"Forced":    sess.MustChangePassword,
+			"MinLength": core.MinPasswordLength,
+			"CSRFToken": sess.CSRFToken,
+		})
+	}
+
 	r.GET("/login", func(c *gin.Context) {
-		if cookie, _ := c.Cookie("session"); cookie == "authenticated" {
+		if _, ok := currentSession(c); ok {
 			c.Redirect(http.StatusSeeOther, "/")
 			return
 		}
-		c.HTML(http.StatusOK, "login.html", gin.H{"Error": ""})
+		renderLogin(c, http.StatusOK, "")
 	})
 
-	r.GET("/logout", func(c *gin.Context) {
-		c.SetCookie("session", "", -1, "/", "", false, true)
+	r.POST("/logout", authRequired, csrfRequired, func(c *gin.Context) {
+		sess := c.MustGet("session").(core.Session)
+		core.DeleteSession(sess.ID)
+		core.Audit(core.AuditLogout, sess.Username, c.ClientIP(), c.Request.UserAgent(), "")
+		setCookie(c, sessionCookie, "", -1)
 		c.Redirect(http.StatusSeeOther, "/login")
 	})
 
 	r.POST("/login", func(c *gin.Context) {
+		expected, _ := c.Cookie(loginCSRFCookie)
+		if !core.CheckCSRF(expected, c.PostForm(csrfFormField)) {
+			renderLogin(c, http.StatusForbidden, "Session expired, please try again")
+			return
+		}
+
 		u := c.PostForm("username")
 		p := c.PostForm("password")
+		ip := c.ClientIP()
+		userAgent := c.Request.UserAgent()
+
+		lockedFor := max(core.IPLoginLimiter.LockedFor(ip), core.UserLoginLimiter.LockedFor(u))
+		if lockedFor > 0 {
+			core.Audit(core.AuditLoginLocked, u, ip, userAgent, fmt.Sprintf("locked for %s", lockedFor.Round(time.Second)))
+			renderLogin(c, http.StatusTooManyRequests,
+				fmt.Sprintf("Too many failed attempts, try again in %d minutes", int(lockedFor.Minutes())+1))
+			return
+		}
 
-		if u == username && p == password {
-			c.SetCookie("session", "authenticated", 3600, "/", "", false, true)
+		if user, err := core.Authenticate(u, p); err == nil {
+			_, token, err := core.CreateSession(user)
+			if err != nil {
+				renderLogin(c, http.StatusInternalServerError, "Could not create session")
+				return
+			}
+			core.UserLoginLimiter.Reset(u)
+			core.Audit(core.AuditLoginSuccess, u, ip, userAgent, "")
+			setCookie(c, loginCSRFCookie, "", -1)
+			setCookie(c, sessionCookie, token, int(core.SessionTTL.Seconds()))
 			c.Redirect(http.StatusSeeOther, "/")
 			return
 		}
 
-		c.HTML(http.StatusUnauthorized, "login.html", gin.H{"Error": "Invalid credentials"})
+		detail := ""
+		if core.UserLoginLimiter.Fail(u) {
+			detail = "username locked out"
+		}
+		if core.IPLoginLimiter.Fail(ip) {
+			detail = strings.TrimPrefix(detail+", IP locked out", ", ")
+		}
+		core.Audit(core.AuditLoginFailure, u, ip, userAgent, detail)
+		renderLogin(c, http.StatusUnauthorized, "Invalid credentials")
+	})
+
+	r.GET("/password", authRequired, func(c *gin.Context) {
+		renderPassword(c, http.StatusOK, "")
 	})
 
-	authRequired := func(c *gin.Context) {
-		session, err := c.Cookie("session")
-		if err != nil || session != "authenticated" {
-			c.Redirect(http.StatusSeeOther, "/login")
-			c.Abort()
+	r.POST("/password", authRequired, csrfRequired, func(c *gin.Context) {
+		sess := c.MustGet("session").(core.Session)
+		password := c.PostForm("new_password")
+		if password != c.PostForm("confirm_password") {
+			renderPassword(c, http.StatusBadRequest, "New passwords do not match")
 			return
 		}
-		c.Next()
-	}
+		if err := core.ChangePassword(sess.Username, c.PostForm("current_password"), password); err != nil {
+			renderPassword(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		core.Audit(core.AuditPasswordChange, sess.Username, c.ClientIP(), c.Request.UserAgent(), "")
+		setCookie(c, sessionCookie, "", -1)
+		c.Redirect(http.StatusSeeOther, "/login")
+	})
 
 	r.GET("/", authRequired, func(c *gin.Context) {
+		sess := c.MustGet("session").(core.Session)
 		c.HTML(http.StatusOK, "index.html", gin.H{
-			"Username": username,
+			"Username":   sess.Username,
+			"Role":       sess.Role,
+			"CanControl": core.RoleAllows(sess.Role, core.ScopeControl),
+			"CanAudit":   core.RoleAllows(sess.Role, core.ScopeAudit),
+			"CSRFToken":  sess.CSRFToken,
 		})
 	})
 
-	r.GET("/api/status", func(c *gin.Context) {
-		summary := core.CalculatePortfolio()
-		core.ConfigMutex.RLock()
-		mode := "PRODUCTION"
-		if core.IsDryRun {
-			mode = "DRY_RUN"
-		}
-		core.ConfigMutex.RUnlock()
+	r.GET("/api/status", apiAuth(core.ScopeRead), func(c *gin.Context) {
+		c.JSON(http.StatusOK, statusPayload(venue))
+	})
 
-		c.JSON(http.StatusOK, gin.H{
-			"status":      "Running",
-			"mode":        mode,
-			"last_run":    time.Now().Format("15:04:05"),
-			"coin_price":  core.RoundFloat(core.LastCoinPrice, 2),
-			"total_value": core.RoundFloat(summary.TotalValue, 2),
-			"roi":         core.RoundFloat(summary.ROI, 2),
-			"portfolio":   summary.Portfolio,
-		})
+	// Pushes portfolio updates, trades, mode changes and errors as they
+	// happen, so the dashboard does not have to poll.
+	r.GET("/api/stream", apiAuth(core.ScopeRead), func(c *gin.Context) {
+		events, unsubscribe := core.SubscribeEvents()
+		defer unsubscribe()
+
+		c.Header("Cache-Control", "no-cache")
+		c.Header("X-Accel-Buffering", "no")
+		c.SSEvent(core.EventPortfolio, statusPayload(venue))
+		c.Writer.Flush()
+
+		keepAlive := time.NewTicker(15 * time.Second)
+		defer keepAlive.Stop()
+		for {
+			select {
+			case <-c.Request.Context().Done():
+				return
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				c.SSEvent(event.Type, event.Data)
+			case <-keepAlive.C:
+				fmt.Fprint(c.Writer, ": keep-alive\n\n")
+			}
+			c.Writer.Flush()
+		}
 	})
 
-	r.GET("/api/history", func(c *gin.Context) {
+	r.GET("/api/history", apiAuth(core.ScopeRead), func(c *gin.Context) {
 		trades, err := core.GetProductionTrades(10)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -105,26 +230,402 @@ func main() {
 		})
 	})
 
-	r.POST("/api/mode/:mode", func(c *gin.Context) {
+	r.POST("/api/mode/:mode", apiAuth(core.ScopeControl), func(c *gin.Context) {
 		newMode := c.Param("mode")
-		core.ConfigMutex.Lock()
-		switch newMode {
-		case "dry":
-			core.IsDryRun = true
-		case "prod":
-			core.IsDryRun = false
+		if newMode != "dry" && newMode != "prod" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "mode must be 'dry' or 'prod'"})
+			return
 		}
 
-		currentMode := core.IsDryRun
-		core.ConfigMutex.Unlock()
+		actor := c.GetString("actor")
+		dryRun := newMode == "dry"
+		if err := core.SetMode(dryRun, actor); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
 
-		go core.SendDiscordModeChange(currentMode)
+		core.Audit(core.AuditModeChange, actor, c.ClientIP(), c.Request.UserAgent(), "mode set to "+newMode)
+		go core.SendDiscordModeChange(dryRun)
 		c.Redirect(http.StatusFound, "/api/status")
 	})
 
+	r.POST("/api/dca/deposit", apiAuth(core.ScopeControl), func(c *gin.Context) {
+		var req struct {
+			AmountTHB float64 `json:"amount_thb"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JSON: " + err.Error()})
+			return
+		}
+
+		actor := c.GetString("actor")
+		if err := core.RecordDCADeposit(req.AmountTHB, actor); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		core.Audit(core.AuditDCADeposit, actor, c.ClientIP(), c.Request.UserAgent(), fmt.Sprintf("deposit %.2f THB", req.AmountTHB))
+		c.JSON(http.StatusOK, core.CurrentDCAStatus())
+	})
+
+	r.GET("/api/equity", apiAuth(core.ScopeRead), func(c *gin.Context) {
+		q := core.EquityQuery{Mode: c.Query("mode")}
+		if q.Mode == "" {
+			if _, dryRun := venue.Current(); dryRun {
+				q.Mode = "DRY_RUN"
+			} else {
+				q.Mode = "PRODUCTION"
+			}
+		}
+
+		var err error
+		if from := c.Query("from"); from != "" {
+			if q.From, err = parseTimeParam(from); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "from: " + err.Error()})
+				return
+			}
+		}
+		if to := c.Query("to"); to != "" {
+			if q.To, err = parseTimeParam(to); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "to: " + err.Error()})
+				return
+			}
+			if len(to) == len("2006-01-02") {
+				// A plain date includes the whole day.
+				q.To = q.To.Add(24*time.Hour - time.Nanosecond)
+			}
+		}
+		if interval := c.Query("interval"); interval != "" {
+			if q.Interval, err = time.ParseDuration(interval); err != nil || q.Interval <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "interval must be a positive duration such as 15m or 1h"})
+				return
+			}
+		}
+		if q.Points, err = strconv.Atoi(c.DefaultQuery("points", "500")); err != nil || q.Points < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "points must be a non-negative integer"})
+			return
+		}
+
+		snapshots, err := core.EquityHistory(q)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"mode": q.Mode, "snapshots": snapshots})
+	})
+
+	r.GET("/api/cashflows", apiAuth(core.ScopeRead), func(c *gin.Context) {
+		mode := c.Query("mode")
+		if mode == "" {
+			if _, dryRun := venue.Current(); dryRun {
+				mode = "DRY_RUN"
+			} else {
+				mode = "PRODUCTION"
+			}
+		}
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+
+		flows, err := core.ListCashFlows(mode, limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"mode": mode, "net_invested": core.NetInvested(mode), "cash_flows": flows})
+	})
+
+	r.POST("/api/cashflows", apiAuth(core.ScopeControl), func(c *gin.Context) {
+		var req struct {
+			Type      string  `json:"type"`
+			AmountTHB float64 `json:"amount_thb"`
+			Timestamp string  `json:"timestamp"`
+			Note      string  `json:"note"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JSON: " + err.Error()})
+			return
+		}
+
+		flow := core.CashFlow{Type: req.Type, AmountTHB: req.AmountTHB, Note: req.Note, CreatedBy: c.GetString("actor")}
+		if req.Timestamp != "" {
+			ts, err := parseTimeParam(req.Timestamp)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			flow.Timestamp = ts
+		}
+		flow.Mode = "PRODUCTION"
+		if _, dryRun := venue.Current(); dryRun {
+			flow.Mode = "DRY_RUN"
+		}
+
+		flow, err := core.RecordCashFlow(flow)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		core.Audit(core.AuditCashFlow, flow.CreatedBy, c.ClientIP(), c.Request.UserAgent(),
+			fmt.Sprintf("%s %s %.2f THB at %s", flow.Mode, flow.Type, flow.AmountTHB, flow.Timestamp.Format(time.RFC3339)))
+		c.JSON(http.StatusOK, flow)
+	})
+
+	r.DELETE("/api/cashflows/:id", apiAuth(core.ScopeControl), func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+			return
+		}
+		if err := core.DeleteCashFlow(id); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		core.Audit(core.AuditCashFlow, c.GetString("actor"), c.ClientIP(), c.Request.UserAgent(), fmt.Sprintf("deleted cash flow %d", id))
+		c.JSON(http.StatusOK, gin.H{"deleted": id})
+	})
+
+	r.POST("/api/cashflows/import", apiAuth(core.ScopeControl), func(c *gin.Context) {
+		added, linked, err := core.ImportBitkubCashFlows(live)
+		if err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error(), "added": added, "linked": linked})
+			return
+		}
+		core.Audit(core.AuditCashFlow, c.GetString("actor"), c.ClientIP(), c.Request.UserAgent(),
+			fmt.Sprintf("imported %d cash flows from Bitkub, linked %d", added, linked))
+		c.JSON(http.StatusOK, gin.H{"added": added, "linked": linked})
+	})
+
+	r.GET("/api/config", apiAuth(core.ScopeRead), func(c *gin.Context) {
+		c.JSON(http.StatusOK, core.CurrentSettings())
+	})
+
+	r.PUT("/api/config", apiAuth(core.ScopeControl), func(c *gin.Context) {
+		var settings core.RuntimeSettings
+		if err := c.ShouldBindJSON(&settings); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JSON: " + err.Error()})
+			return
+		}
+
+		actor := c.GetString("actor")
+		if err := core.UpdateSettings(settings, actor); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		updated := core.CurrentSettings()
+		core.Audit(core.AuditConfigChange, actor, c.ClientIP(), c.Request.UserAgent(), updated.Summary())
+		c.JSON(http.StatusOK, updated)
+	})
+
+	r.GET("/api/config/history", apiAuth(core.ScopeRead), func(c *gin.Context) {
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+		if err != nil || limit <= 0 || limit > 500 {
+			limit = 20
+		}
+
+		versions, err := core.SettingsHistory(limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"versions": versions})
+	})
+
+	r.GET("/api/audit", apiAuth(core.ScopeAudit), func(c *gin.Context) {
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+		if err != nil || limit <= 0 || limit > 1000 {
+			limit = 50
+		}
+
+		entries, err := core.GetAuditLog(limit, c.Query("event"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"entries": entries})
+	})
+
+	watchConfig()
+
+	go publishPortfolio(ctx, venue)
+
+	botDone := make(chan struct{})
 	go func() {
+		defer close(botDone)
 		core.SendDiscordStartup()
-		core.StartBotLoop()
+		core.StartBotLoop(ctx, venue)
+	}()
+
+	srv := &http.Server{Addr: ":8888", Handler: r}
+	// Event streams never go idle, so end them or Shutdown would wait for them.
+	srv.RegisterOnShutdown(core.CloseEventStreams)
+	serverErr := make(chan error, 1)
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			serverErr <- err
+		}
+	}()
+
+	stopSignals := make(chan os.Signal, 1)
+	signal.Notify(stopSignals, os.Interrupt, syscall.SIGTERM)
+
+	reason := ""
+	select {
+	case sig := <-stopSignals:
+		reason = "signal " + sig.String()
+	case err := <-serverErr:
+		reason = "HTTP server error: " + err.Error()
+	}
+	// A second signal kills the process the default way.
+	signal.Stop(stopSignals)
+
+	shutdown(srv, cancel, botDone, reason)
+}
+
+// statusPayload is what /api/status returns and /api/stream pushes. It is
+// built from the market data cache, so it never calls Bitkub unless nothing
+// is cached yet.
+func statusPayload(venue core.Venue) gin.H {
+	exchange, dryRun := venue.Current()
+	mode := "PRODUCTION"
+	if dryRun {
+		mode = "DRY_RUN"
+	}
+	summary, prices, market := core.CachedPortfolio(exchange, mode)
+	returns := core.CalculateReturns(mode, summary.TotalValue)
+
+	lastRun := "-"
+	if !market.FetchedAt.IsZero() {
+		lastRun = market.FetchedAt.Format("15:04:05")
+	}
+	nextRun := ""
+	if next := core.NextRun(); !next.IsZero() {
+		nextRun = next.Format("15:04:05 02/01/2006")
+	}
+
+	return gin.H{
+		"status":      "Running",
+		"mode":        mode,
+		"last_run":    lastRun,
+		"market_data": market,
+		"price_feed":  core.CurrentPriceFeedStatus(),
+		"next_run":    nextRun,
+		"schedule":    core.ScheduleSummary(),
+		"strategy":    core.StrategySummary(),
+		"dca":         core.CurrentDCAStatus(),
+		"prices":      prices,
+		"total_value": core.RoundFloat(summary.TotalValue, 2),
+		"roi":         core.RoundFloat(returns.ROI, 2),
+		"returns":     returns,
+		"portfolio":   summary.Portfolio,
+	}
+}
+
+// publishPortfolio pushes the status to every open stream when it changes.
+// It is built once per change however many dashboards are open, and at most
+// once a second since streamed prices can change many times a second.
+func publishPortfolio(ctx context.Context, venue core.Venue) {
+	var last []byte
+	refresh := time.NewTicker(5 * time.Second)
+	defer refresh.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-core.PortfolioChanged():
+		case <-refresh.C:
+		}
+		if core.EventSubscribers() == 0 {
+			last = nil
+			continue
+		}
+
+		data, err := json.Marshal(statusPayload(venue))
+		if err != nil || bytes.Equal(data, last) {
+			continue
+		}
+		last = data
+		core.PublishEvent(core.EventPortfolio, json.RawMessage(data))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// shutdown stops the bot loop and the HTTP server, waits for an order in
+// flight to be logged, then announces the shutdown and drains Discord.
+func shutdown(srv *http.Server, stopBot context.CancelFunc, botDone <-chan struct{}, reason string) {
+	timeout := 10 * time.Second
+	if val, err := strconv.Atoi(os.Getenv("SHUTDOWN_TIMEOUT_SECONDS")); err == nil && val > 0 {
+		timeout = time.Duration(val) * time.Second
+	}
+
+	fmt.Printf("🛑 Shutting down (%s), press Ctrl+C again to force\n", reason)
+	stopBot()
+
+	httpCtx, cancelHTTP := context.WithTimeout(context.Background(), timeout)
+	defer cancelHTTP()
+	if err := srv.Shutdown(httpCtx); err != nil {
+		fmt.Printf("⚠️ HTTP server did not stop cleanly: %v\n", err)
+	}
+
+	// No timeout here: the loop only blocks while an order is being placed,
+	// cancelled or logged, and cutting that short is what this avoids.
+	waiting := time.NewTicker(5 * time.Second)
+	defer waiting.Stop()
+	for done := false; !done; {
+		select {
+		case <-botDone:
+			done = true
+		case <-waiting.C:
+			fmt.Println("⏳ Waiting for the in-flight rebalance to finish...")
+		}
+	}
+
+	core.SendDiscordShutdown(reason)
+	if !core.DrainDiscord(timeout) {
+		fmt.Println("⚠️ Some Discord notifications were not sent before shutdown")
+	}
+	fmt.Println("👋 Bot stopped")
+}
+
+// watchConfig reloads the config on SIGHUP and, when CONFIG_FILE is set,
+// whenever the file changes (polled every CONFIG_WATCH_SECONDS, 0 = off).
+func watchConfig() {
+	path := os.Getenv("CONFIG_FILE")
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			core.ReloadConfig(path, "SIGHUP")
+		}
 	}()
-	r.Run(":8888")
+
+	if path == "" {
+		return
+	}
+	every := 5
+	if val, err := strconv.Atoi(os.Getenv("CONFIG_WATCH_SECONDS")); err == nil && val >= 0 {
+		every = val
+	}
+	if every > 0 {
+		go core.WatchConfigFile(path, time.Duration(every)*time.Second)
+		fmt.Printf("👀 Watching %s for changes every %ds\n", path, every)
+	}
+}
+
+// parseTimeParam accepts RFC3339 or a plain date (local midnight), as sent
+// by the dashboard's date inputs.
+func parseTimeParam(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("timestamp must be RFC3339 or YYYY-MM-DD")
 }
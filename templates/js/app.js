@@ -1,11 +1,20 @@
 const modeDisplay = document.getElementById('mode-display');
         const modeStatusBox = document.getElementById('mode-status-box');
         const lastRunDisplay = document.getElementById('last-run-display');
-        const ethPriceDisplay = document.getElementById('eth-price-display');
+        const staleDisplay = document.getElementById('stale-display');
+        const nextRunDisplay = document.getElementById('next-run-display');
+        const scheduleDisplay = document.getElementById('schedule-display');
+        const strategyDisplay = document.getElementById('strategy-display');
+        const dcaDisplay = document.getElementById('dca-display');
         const totalValueDisplay = document.getElementById('total-value-display');
         const roiDisplay = document.getElementById('roi-display');
+        const netInvestedDisplay = document.getElementById('net-invested-display');
+        const twrDisplay = document.getElementById('twr-display');
+        const mwrDisplay = document.getElementById('mwr-display');
         const balanceTableBody = document.getElementById('balance-data');
 
+        const csrfToken = document.querySelector('meta[name="csrf-token"]').content;
+
         const numberFormatter = new Intl.NumberFormat('en-US', {
             minimumFractionDigits: 2,
             maximumFractionDigits: 2,
@@ -19,63 +28,125 @@ const modeDisplay = document.getElementById('mode-display');
         async function fetchStatus() {
             try {
                 const response = await fetch('/api/status');
-                const data = await response.json();
+                if (response.status === 401) {
+                    window.location.href = '/login';
+                    return;
+                }
+                renderStatus(await response.json());
+            } catch (error) {
+                console.error('Error fetching status:', error);
+                const row = balanceTableBody.insertRow();
+                row.insertCell(0).textContent = "❌ ไม่สามารถเชื่อมต่อกับ Go Backend ได้";
+                row.cells[0].colSpan = 6;
+                balanceTableBody.innerHTML = row.outerHTML;
+            }
+        }
 
-                modeDisplay.textContent = data.mode;
-                modeStatusBox.className = 'status-box ' + (data.mode === 'DRY_RUN' ? 'dry-run' : 'production');
-                lastRunDisplay.textContent = data.last_run;
+        function renderStatus(data) {
+            modeDisplay.textContent = data.mode;
+            modeStatusBox.className = 'status-box ' + (data.mode === 'DRY_RUN' ? 'dry-run' : 'production');
+            lastRunDisplay.textContent = data.last_run;
+            showStaleness(data.market_data);
+            nextRunDisplay.textContent = data.next_run || '-';
+            scheduleDisplay.textContent = data.schedule ? `(${data.schedule})` : '';
+            strategyDisplay.textContent = data.strategy || '-';
+            dcaDisplay.textContent = formatDCA(data.dca);
 
-                ethPriceDisplay.textContent = numberFormatter.format(data.coin_price || 0);
-                totalValueDisplay.textContent = numberFormatter.format(data.total_value || 0) + ' THB';
+            totalValueDisplay.textContent = numberFormatter.format(data.total_value || 0) + ' THB';
 
-                const roiValue = data.roi || 0;
-                roiDisplay.textContent = roiValue.toFixed(2) + '%';
-                roiDisplay.className = roiValue >= 0 ? 'roi-positive' : 'roi-negative';
+            const roiValue = data.roi || 0;
+            roiDisplay.textContent = roiValue.toFixed(2) + '%';
+            roiDisplay.className = roiValue >= 0 ? 'roi-positive' : 'roi-negative';
 
-                balanceTableBody.innerHTML = '';
+            const returns = data.returns || {};
+            netInvestedDisplay.textContent = numberFormatter.format(returns.net_invested || 0) + ' THB';
+            showReturn(twrDisplay, returns.twr);
+            showReturn(mwrDisplay, returns.mwr);
 
-                if (Array.isArray(data.portfolio)) {
-                    data.portfolio.forEach(asset => {
-                        const row = balanceTableBody.insertRow();
+            balanceTableBody.innerHTML = '';
 
-                        const displayCoinBalance = asset.coin_balance || 0;
-                        const displayBalanceTHB = asset.balance_thb || 0;
-                        const displayActualPct = asset.actual_pct || 0;
-                        const displayTargetPct = asset.target_pct || 0;
+            if (Array.isArray(data.portfolio)) {
+                data.portfolio.forEach(asset => {
+                    const row = balanceTableBody.insertRow();
 
-                        const deviation = Math.abs(displayActualPct - displayTargetPct);
-                        let rowClass = deviation > 5 ? 'style="background-color: #fff3cd;"' : '';
-                        row.setAttribute('style', rowClass);
+                    const displayCoinBalance = asset.coin_balance || 0;
+                    const displayBalanceTHB = asset.balance_thb || 0;
+                    const displayActualPct = asset.actual_pct || 0;
+                    const displayTargetPct = asset.target_pct || 0;
 
-                        row.insertCell().textContent = asset.asset;
+                    const deviation = Math.abs(displayActualPct - displayTargetPct);
+                    let rowClass = deviation > 5 ? 'style="background-color: #fff3cd;"' : '';
+                    row.setAttribute('style', rowClass);
 
-                        let coinBalanceText = '';
-                        if (asset.asset === 'THB') {
-                            coinBalanceText = numberFormatter.format(displayCoinBalance);
-                        } else {
-                            coinBalanceText = coinFormatter.format(displayCoinBalance);
-                        }
-                        row.insertCell().textContent = coinBalanceText;
+                    row.insertCell().textContent = asset.asset;
+                    row.insertCell().textContent = numberFormatter.format(asset.current_price || 0);
 
-                        row.insertCell().textContent = numberFormatter.format(displayBalanceTHB);
-                        row.insertCell().textContent = displayActualPct.toFixed(2) + '%';
-                        row.insertCell().textContent = displayTargetPct.toFixed(2) + '%';
-                    });
-                } else {
-                    const row = balanceTableBody.insertRow();
-                    row.insertCell(0).textContent = "ไม่พบข้อมูลพอร์ตโฟลิโอ หรือรูปแบบข้อมูลไม่ถูกต้อง";
-                    row.cells[0].colSpan = 5;
-                }
+                    let coinBalanceText = '';
+                    if (asset.asset === 'THB') {
+                        coinBalanceText = numberFormatter.format(displayCoinBalance);
+                    } else {
+                        coinBalanceText = coinFormatter.format(displayCoinBalance);
+                    }
+                    row.insertCell().textContent = coinBalanceText;
 
-            } catch (error) {
-                console.error('Error fetching status:', error);
+                    row.insertCell().textContent = numberFormatter.format(displayBalanceTHB);
+                    row.insertCell().textContent = displayActualPct.toFixed(2) + '%';
+                    row.insertCell().textContent = displayTargetPct.toFixed(2) + '%';
+                });
+            } else {
                 const row = balanceTableBody.insertRow();
-                row.insertCell(0).textContent = "❌ ไม่สามารถเชื่อมต่อกับ Go Backend ได้";
-                row.cells[0].colSpan = 5;
-                balanceTableBody.innerHTML = row.outerHTML;
+                row.insertCell(0).textContent = "ไม่พบข้อมูลพอร์ตโฟลิโอ หรือรูปแบบข้อมูลไม่ถูกต้อง";
+                row.cells[0].colSpan = 6;
             }
         }
 
+        // The server pushes the status, new trades, mode changes and errors
+        // over one stream. Polling /api/status is only a fallback while the
+        // stream is down (it also sends an expired session to the login page).
+        let statusPoll = null;
+
+        function connectStream() {
+            const stream = new EventSource('/api/stream');
+
+            stream.addEventListener('portfolio', event => renderStatus(JSON.parse(event.data)));
+            stream.addEventListener('trade', event => {
+                if (JSON.parse(event.data).mode === 'PRODUCTION') {
+                    fetchHistory();
+                }
+            });
+            stream.addEventListener('mode', () => {
+                fetchSettingsHistory();
+                fetchCashFlows();
+                fetchEquity();
+            });
+            stream.addEventListener('bot_error', event => showBotError(JSON.parse(event.data)));
+
+            stream.onopen = () => {
+                clearInterval(statusPoll);
+                statusPoll = null;
+            };
+            stream.onerror = () => {
+                if (!statusPoll) {
+                    statusPoll = setInterval(fetchStatus, 5000);
+                }
+                // The browser retries by itself unless the server refused the stream.
+                if (stream.readyState === EventSource.CLOSED) {
+                    setTimeout(connectStream, 5000);
+                }
+            };
+        }
+
+        function showBotError(error) {
+            const banner = document.getElementById('error-banner');
+            document.getElementById('error-message').textContent =
+                `${new Date(error.time).toLocaleTimeString('th-TH')} ${error.message}`;
+            banner.style.display = 'block';
+        }
+
+        function hideBotError() {
+            document.getElementById('error-banner').style.display = 'none';
+        }
+
         async function fetchHistory() {
             try {
                 const response = await fetch('/api/history');
@@ -98,16 +169,17 @@ const modeDisplay = document.getElementById('mode-display');
                     const opCell = row.insertCell();
                     opCell.textContent = trade.operation.toUpperCase();
                     opCell.style.fontWeight = 'bold';
-                    if (trade.operation === 'buy') {
+                    if (trade.operation === 'buy' || trade.operation === 'dca_buy') {
                         opCell.style.color = 'green';
                     } else {
                         opCell.style.color = 'red';
                     }
 
-                    row.insertCell().textContent = numberFormatter.format(trade.price);
+                    row.insertCell().textContent = numberFormatter.format(trade.fill_price || trade.price);
                     row.insertCell().textContent = numberFormatter.format(trade.amount_thb);
                     row.insertCell().textContent = coinFormatter.format(trade.coin_amount);
-                    row.insertCell().textContent = trade.deviation.toFixed(2) + '%';
+                    // DCA buys invest new cash, they are not a response to a deviation.
+                    row.insertCell().textContent = trade.operation === 'dca_buy' ? 'DCA' : trade.deviation.toFixed(2) + '%';
                 });
 
             } catch (error) {
@@ -115,11 +187,221 @@ const modeDisplay = document.getElementById('mode-display');
             }
         }
 
+        // The status is served from a cache the bot refreshes; warn when it has
+        // not managed to for longer than the TTL.
+        function showStaleness(market) {
+            if (!market || !market.stale) {
+                staleDisplay.textContent = '';
+                staleDisplay.title = '';
+                return;
+            }
+            staleDisplay.textContent = market.age_seconds > 0
+                ? `⚠️ ข้อมูลเก่า ${Math.round(market.age_seconds)} วินาที`
+                : '⚠️ ดึงข้อมูลไม่ได้';
+            staleDisplay.title = market.error || '';
+        }
+
+        // TWR and MWR are null until there is enough history.
+        function showReturn(element, value) {
+            if (value === null || value === undefined) {
+                element.textContent = '-';
+                element.className = '';
+                return;
+            }
+            element.textContent = value.toFixed(2) + '%';
+            element.className = value >= 0 ? 'roi-positive' : 'roi-negative';
+        }
+
+        async function fetchCashFlows() {
+            const tbody = document.getElementById('cashflow-data');
+            const canControl = document.getElementById('cashflow-form') !== null;
+
+            try {
+                const response = await fetch('/api/cashflows?limit=50');
+                const data = await response.json();
+
+                tbody.innerHTML = '';
+
+                if (!data.cash_flows || data.cash_flows.length === 0) {
+                    const row = tbody.insertRow();
+                    row.innerHTML = `<td colspan="6" style="text-align: center;">ยังไม่มีรายการ</td>`;
+                    return;
+                }
+
+                data.cash_flows.forEach(flow => {
+                    const row = tbody.insertRow();
+                    row.insertCell().textContent = new Date(flow.timestamp).toLocaleString('th-TH');
+
+                    const typeCell = row.insertCell();
+                    typeCell.textContent = flow.type === 'deposit' ? 'ฝาก' : 'ถอน';
+                    typeCell.style.color = flow.type === 'deposit' ? 'green' : 'red';
+
+                    row.insertCell().textContent = numberFormatter.format(flow.amount_thb);
+                    row.insertCell().textContent = flow.reference ? `${flow.source} (${flow.reference})` : flow.source;
+                    row.insertCell().textContent = flow.note || '';
+
+                    const actionCell = row.insertCell();
+                    if (canControl) {
+                        const button = document.createElement('button');
+                        button.textContent = 'ลบ';
+                        button.onclick = () => deleteCashFlow(flow.id);
+                        actionCell.appendChild(button);
+                    }
+                });
+
+            } catch (error) {
+                console.error('Error fetching cash flows:', error);
+            }
+        }
+
+        async function addCashFlow(event) {
+            event.preventDefault();
+            const message = document.getElementById('cashflow-message');
+
+            const payload = {
+                type: document.getElementById('cashflow-type-input').value,
+                amount_thb: parseFloat(document.getElementById('cashflow-amount-input').value),
+                timestamp: document.getElementById('cashflow-date-input').value,
+                note: document.getElementById('cashflow-note-input').value,
+            };
+
+            try {
+                const response = await fetch('/api/cashflows', {
+                    method: 'POST',
+                    headers: { 'Content-Type': 'application/json', 'X-CSRF-Token': csrfToken },
+                    body: JSON.stringify(payload),
+                });
+                const data = await response.json();
+                if (!response.ok) {
+                    message.textContent = '❌ ' + data.error;
+                    return;
+                }
+                message.textContent = '✅ บันทึกแล้ว';
+                document.getElementById('cashflow-form').reset();
+                fetchCashFlows();
+                fetchStatus();
+            } catch (error) {
+                console.error('Error adding cash flow:', error);
+                message.textContent = '❌ เกิดข้อผิดพลาดในการบันทึก';
+            }
+        }
+
+        async function deleteCashFlow(id) {
+            if (!confirm('ต้องการลบรายการนี้หรือไม่?')) {
+                return;
+            }
+            try {
+                const response = await fetch(`/api/cashflows/${id}`, {
+                    method: 'DELETE',
+                    headers: { 'X-CSRF-Token': csrfToken },
+                });
+                if (!response.ok) {
+                    const data = await response.json();
+                    alert('ลบไม่สำเร็จ: ' + data.error);
+                }
+                fetchCashFlows();
+                fetchStatus();
+            } catch (error) {
+                console.error('Error deleting cash flow:', error);
+            }
+        }
+
+        async function importCashFlows() {
+            const message = document.getElementById('cashflow-message');
+            message.textContent = '⏳ กำลังดึงข้อมูล...';
+
+            try {
+                const response = await fetch('/api/cashflows/import', {
+                    method: 'POST',
+                    headers: { 'X-CSRF-Token': csrfToken },
+                });
+                const data = await response.json();
+                if (!response.ok) {
+                    message.textContent = '❌ ' + data.error;
+                    return;
+                }
+                message.textContent = `✅ เพิ่ม ${data.added} รายการ, จับคู่ ${data.linked} รายการ`;
+                fetchCashFlows();
+                fetchStatus();
+            } catch (error) {
+                console.error('Error importing cash flows:', error);
+                message.textContent = '❌ เกิดข้อผิดพลาดในการดึงข้อมูล';
+            }
+        }
+
+        let equityRangeDays = 30;
+
+        // Draws the equity curve as an SVG polyline, with net invested cash as a
+        // dashed line so deposits are not mistaken for gains.
+        async function fetchEquity() {
+            const svg = document.getElementById('equity-chart');
+            const summary = document.getElementById('equity-summary');
+
+            let url = '/api/equity?points=300';
+            if (equityRangeDays > 0) {
+                const from = new Date(Date.now() - equityRangeDays * 24 * 60 * 60 * 1000);
+                url += '&from=' + encodeURIComponent(from.toISOString());
+            }
+
+            try {
+                const response = await fetch(url);
+                const data = await response.json();
+                const points = data.snapshots || [];
+
+                if (points.length < 2) {
+                    svg.innerHTML = '<text x="400" y="130" text-anchor="middle">ยังมีข้อมูลไม่พอสำหรับกราฟ</text>';
+                    summary.textContent = '';
+                    return;
+                }
+
+                const width = 800, height = 260, pad = 30;
+                const times = points.map(p => new Date(p.timestamp).getTime());
+                const values = points.flatMap(p => [p.total_value, p.net_invested]);
+                const minT = times[0], maxT = times[times.length - 1];
+                let minV = Math.min(...values), maxV = Math.max(...values);
+                if (maxV === minV) {
+                    minV -= 1;
+                    maxV += 1;
+                }
+
+                const x = t => pad + (t - minT) / (maxT - minT || 1) * (width - 2 * pad);
+                const y = v => height - pad - (v - minV) / (maxV - minV) * (height - 2 * pad);
+                const line = key => points.map((p, i) => `${x(times[i]).toFixed(1)},${y(p[key]).toFixed(1)}`).join(' ');
+
+                svg.innerHTML = `
+                    <polyline class="invested-line" points="${line('net_invested')}"></polyline>
+                    <polyline class="value-line" points="${line('total_value')}"></polyline>
+                    <text x="${pad}" y="${pad - 10}">${numberFormatter.format(maxV)}</text>
+                    <text x="${pad}" y="${height - 8}">${numberFormatter.format(minV)}</text>
+                    <text x="${width - pad}" y="${height - 8}" text-anchor="end">${new Date(maxT).toLocaleString('th-TH')}</text>`;
+
+                const first = points[0].total_value, last = points[points.length - 1].total_value;
+                summary.textContent = `${numberFormatter.format(first)} → ${numberFormatter.format(last)} THB (${points.length} จุด)`;
+            } catch (error) {
+                console.error('Error fetching equity:', error);
+            }
+        }
+
+        document.querySelectorAll('.equity-ranges button').forEach(button => {
+            button.addEventListener('click', () => {
+                document.querySelectorAll('.equity-ranges button').forEach(b => b.classList.remove('active'));
+                button.classList.add('active');
+                equityRangeDays = parseInt(button.dataset.range, 10);
+                fetchEquity();
+            });
+        });
+
         async function toggleMode(newMode) {
             if (confirm(`คุณแน่ใจหรือไม่ที่จะเปลี่ยนโหมดเป็น ${newMode.toUpperCase()}?`)) {
                 try {
-                    await fetch(`/api/mode/${newMode}`, { method: 'POST' });
+                    await fetch(`/api/mode/${newMode}`, {
+                        method: 'POST',
+                        headers: { 'X-CSRF-Token': csrfToken },
+                    });
                     fetchStatus();
+                    fetchSettingsHistory();
+                    fetchCashFlows();
+                    fetchEquity();
                 } catch (error) {
                     console.error('Error toggling mode:', error);
                     alert('เกิดข้อผิดพลาดในการเปลี่ยนโหมด');
@@ -127,7 +409,213 @@ const modeDisplay = document.getElementById('mode-display');
             }
         }
 
-        setInterval(fetchStatus, 1000);
-        setInterval(fetchHistory, 30000);
-        fetchStatus();
-        fetchHistory();
\ No newline at end of file
+        async function fetchAudit() {
+            const tbody = document.getElementById('audit-data');
+            if (!tbody) {
+                return;
+            }
+
+            try {
+                const response = await fetch('/api/audit?limit=50');
+                const data = await response.json();
+
+                tbody.innerHTML = '';
+
+                if (!data.entries || data.entries.length === 0) {
+                    const row = tbody.insertRow();
+                    row.innerHTML = `<td colspan="6" style="text-align: center;">ยังไม่มีรายการ</td>`;
+                    return;
+                }
+
+                data.entries.forEach(entry => {
+                    const row = tbody.insertRow();
+                    row.insertCell().textContent = entry.timestamp;
+                    row.insertCell().textContent = entry.event;
+                    row.insertCell().textContent = entry.username;
+                    row.insertCell().textContent = entry.ip;
+                    row.insertCell().textContent = entry.user_agent;
+                    row.insertCell().textContent = entry.detail;
+                });
+
+            } catch (error) {
+                console.error('Error fetching audit log:', error);
+            }
+        }
+
+        async function fetchSettingsHistory() {
+            const tbody = document.getElementById('settings-history-data');
+
+            try {
+                const response = await fetch('/api/config/history?limit=20');
+                const data = await response.json();
+
+                tbody.innerHTML = '';
+
+                if (!data.versions || data.versions.length === 0) {
+                    const row = tbody.insertRow();
+                    row.innerHTML = `<td colspan="5" style="text-align: center;">ยังไม่มีรายการ</td>`;
+                    return;
+                }
+
+                data.versions.forEach(version => {
+                    const row = tbody.insertRow();
+                    row.insertCell().textContent = version.version;
+                    row.insertCell().textContent = version.updated_at;
+                    row.insertCell().textContent = version.updated_by;
+                    row.insertCell().textContent = version.source;
+                    row.insertCell().textContent = (version.changes && version.changes.length > 0)
+                        ? version.changes.join(', ')
+                        : '-';
+                });
+
+            } catch (error) {
+                console.error('Error fetching settings history:', error);
+            }
+        }
+
+        function addTargetRow(asset, pct) {
+            const tbody = document.getElementById('targets-data');
+            const row = tbody.insertRow();
+
+            const assetInput = document.createElement('input');
+            assetInput.className = 'target-asset';
+            assetInput.value = asset;
+            assetInput.required = true;
+            row.insertCell().appendChild(assetInput);
+
+            const pctInput = document.createElement('input');
+            pctInput.type = 'number';
+            pctInput.className = 'target-pct';
+            pctInput.step = '0.01';
+            pctInput.min = '0';
+            pctInput.value = pct;
+            pctInput.addEventListener('input', updateTargetsSum);
+            row.insertCell().appendChild(pctInput);
+
+            updateTargetsSum();
+        }
+
+        function updateTargetsSum() {
+            let sum = 0;
+            document.querySelectorAll('#targets-data .target-pct').forEach(input => {
+                sum += parseFloat(input.value) || 0;
+            });
+            document.getElementById('targets-sum').textContent = sum.toFixed(2);
+        }
+
+        async function loadSettings() {
+            const form = document.getElementById('settings-form');
+            if (!form) {
+                return;
+            }
+
+            try {
+                const response = await fetch('/api/config');
+                const data = await response.json();
+
+                document.getElementById('targets-data').innerHTML = '';
+                Object.keys(data.targets).sort().forEach(asset => addTargetRow(asset, data.targets[asset]));
+                document.getElementById('threshold-input').value = data.threshold;
+                document.getElementById('interval-input').value = data.interval_seconds;
+                document.getElementById('min-order-input').value = data.min_order_thb;
+            } catch (error) {
+                console.error('Error loading settings:', error);
+            }
+        }
+
+        function formatDCA(dca) {
+            if (!dca || dca.mode === 'off') {
+                return 'ปิด';
+            }
+            let text = dca.mode === 'fixed'
+                ? `ซื้อ ${numberFormatter.format(dca.amount_thb)} THB ทุกรอบ ${dca.period}`
+                : `แบ่งเงินฝากลงทุนรอบ ${dca.period}`;
+            if (dca.pending_thb > 0) {
+                text += ` | รอลงทุน ${numberFormatter.format(dca.pending_thb)} THB`;
+                if (dca.mode === 'split') {
+                    text += ` (อีก ${dca.periods_left} รอบ)`;
+                }
+            }
+            if (dca.retry_thb > 0) {
+                text += ` | รอซื้อซ้ำ ${numberFormatter.format(dca.retry_thb)} THB`;
+            }
+            return text;
+        }
+
+        async function recordDeposit(event) {
+            event.preventDefault();
+            const message = document.getElementById('dca-message');
+            const amount = parseFloat(document.getElementById('dca-amount-input').value);
+
+            try {
+                const response = await fetch('/api/dca/deposit', {
+                    method: 'POST',
+                    headers: { 'Content-Type': 'application/json', 'X-CSRF-Token': csrfToken },
+                    body: JSON.stringify({ amount_thb: amount }),
+                });
+                const data = await response.json();
+                if (!response.ok) {
+                    message.textContent = '❌ ' + data.error;
+                    return;
+                }
+                message.textContent = '✅ บันทึกแล้ว';
+                document.getElementById('dca-amount-input').value = '';
+                fetchStatus();
+                fetchCashFlows();
+            } catch (error) {
+                console.error('Error recording deposit:', error);
+                message.textContent = '❌ เกิดข้อผิดพลาดในการบันทึก';
+            }
+        }
+
+        async function saveSettings(event) {
+            event.preventDefault();
+            const message = document.getElementById('settings-message');
+
+            const targets = {};
+            document.querySelectorAll('#targets-data tr').forEach(row => {
+                const asset = row.querySelector('.target-asset').value.trim().toUpperCase();
+                if (asset) {
+                    targets[asset] = parseFloat(row.querySelector('.target-pct').value) || 0;
+                }
+            });
+
+            const payload = {
+                targets: targets,
+                threshold: parseFloat(document.getElementById('threshold-input').value),
+                interval_seconds: parseInt(document.getElementById('interval-input').value, 10),
+                min_order_thb: parseFloat(document.getElementById('min-order-input').value),
+            };
+
+            try {
+                const response = await fetch('/api/config', {
+                    method: 'PUT',
+                    headers: { 'Content-Type': 'application/json', 'X-CSRF-Token': csrfToken },
+                    body: JSON.stringify(payload),
+                });
+                const data = await response.json();
+                if (!response.ok) {
+                    message.textContent = '❌ ' + data.error;
+                    return;
+                }
+                message.textContent = '✅ บันทึกแล้ว';
+                loadSettings();
+                fetchSettingsHistory();
+                fetchStatus();
+            } catch (error) {
+                console.error('Error saving settings:', error);
+                message.textContent = '❌ เกิดข้อผิดพลาดในการบันทึก';
+            }
+        }
+
+        setInterval(fetchAudit, 30000);
+        setInterval(fetchSettingsHistory, 30000);
+        setInterval(fetchCashFlows, 30000);
+        setInterval(fetchEquity, 60000);
+        connectStream();
+        fetchHistory();
+        fetchAudit();
+        fetchSettingsHistory();
+        fetchCashFlows();
+        fetchEquity();
+        loadSettings();
\ No newline at end of file